@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 	"github.com/snowwhiteai/mcp-pandoc-go/internal/logging"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/sandbox"
 	"github.com/snowwhiteai/mcp-pandoc-go/internal/tools"
 )
 
@@ -55,43 +61,357 @@ func main() {
 	logger.FileOperation("TEST", logDir, true, "Проверка записи операций с файлами")
 	logger.ConversionOperation("test", "test", "Проверка записи операций конвертации", true)
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Реестр выполняющихся вызовов для обработки notifications/cancelled
+	cancellations := tools.NewCancelRegistry()
+	hooks := &server.Hooks{}
+	hooks.AddBeforeCallTool(cancellations.BeforeCallTool)
+
 	// Create MCP server
 	s := server.NewMCPServer(
 		"Pandoc Document Converter",
 		"1.0.0",
 		server.WithLogging(),
+		server.WithHooks(hooks),
+		server.WithToolHandlerMiddleware(cancellations.Middleware),
 	)
+	s.AddNotificationHandler("notifications/cancelled", cancellations.HandleNotification)
+
+	// Политика доступа к файлам: корни из конфигурации и из roots/list клиента
+	policy := sandbox.FromEnv()
+	if policy.Restricted() {
+		logger.Info("File access restricted to roots: read %v, write %v", policy.Roots(sandbox.AccessRead), policy.Roots(sandbox.AccessWrite))
+	} else {
+		logger.Info("No allowed roots configured, file access is limited by the deny list only until the client sends its roots")
+	}
+
+	// Один конвертер на всё время работы сервера; без Pandoc сервер не запускается
+	converter, err := pandoc.NewConverter()
+	if err != nil {
+		logger.Error("Pandoc недоступен: %v", err)
+		os.Stderr.WriteString("ERROR: " + err.Error() + "\n" + pandoc.ErrorHint(err) + "\n")
+		os.Exit(1)
+	}
+	if probe, err := converter.Probe(); err == nil {
+		logger.Info("Using pandoc %s at %s (features: %s)", probe.Version, probe.Path, probe.Features)
+	}
+
+	// Определяем форматы, поддерживаемые установленным Pandoc
+	capabilities := pandoc.FallbackCapabilities()
+	if discovered, err := converter.DiscoverCapabilities(ctx); err != nil {
+		logger.Error("Не удалось получить список форматов Pandoc, используется встроенный список: %v", err)
+	} else {
+		capabilities = discovered
+		logger.Info("Pandoc supports %d input formats, %d output formats, %d extensions",
+			len(capabilities.InputFormats), len(capabilities.OutputFormats), len(capabilities.Extensions))
+	}
+
+	// Зарегистрированные фильтры Pandoc (встроенные и из каталога фильтров)
+	filterItems := map[string]any{"type": "string"}
+	filterRegistry := converter.Filters()
+	if filters, err := filterRegistry.List(); err != nil {
+		logger.Error("Не удалось получить список фильтров: %v", err)
+	} else {
+		names := make([]string, 0, len(filters))
+		for _, f := range filters {
+			names = append(names, f.Name)
+		}
+		filterItems["enum"] = names
+		logger.Info("Registered %d pandoc filters from %s and built-ins", len(names), filterRegistry.Dir())
+	}
+
+	// Conversion options shared by the conversion tools
+	optionArgs := []mcp.ToolOption{
+		mcp.WithString("on_exists",
+			mcp.Description("What to do if output_file exists: overwrite (default), fail, rename (write report-1.docx, report-2.docx, ...) or backup (keep the old file as <name>.bak); the path actually written is returned"),
+			mcp.Enum("overwrite", "fail", "rename", "backup"),
+		),
+		mcp.WithBoolean("branding",
+			mcp.Description("Add the server's configured header/footer branding (true) or skip it (false); omit to use the server default"),
+		),
+		mcp.WithString("template",
+			mcp.Description("Name of a template from list_templates; applies its reference document (docx/odt/pptx), pandoc template and CSS for the output format"),
+		),
+		mcp.WithArray("filters",
+			mcp.Description("Registered pandoc filters to run, in order (built-in: remove-comments, relative-link-rewrite, heading-anchors, chapter-breaks)"),
+			mcp.Items(filterItems),
+		),
+		mcp.WithString("bibliography",
+			mcp.Description("Bibliography file for citations (.bib, .bibtex, .json CSL JSON, .yaml/.yml CSL YAML, .ris); enables citation processing"),
+		),
+		mcp.WithArray("references",
+			mcp.Description("Inline CSL JSON references, each with an id matching a citation key, e.g. [{\"id\": \"doe2020\", \"type\": \"book\", \"title\": \"...\"}]"),
+			mcp.Items(map[string]any{"type": "object"}),
+		),
+		mcp.WithString("csl",
+			mcp.Description("Citation style name from the server's styles directory, e.g. apa or ieee"),
+		),
+		mcp.WithBoolean("link_citations",
+			mcp.Description("Link citations to their bibliography entries"),
+		),
+		mcp.WithBoolean("link_bibliography",
+			mcp.Description("Make DOIs and URLs in the bibliography clickable"),
+		),
+		mcp.WithBoolean("toc",
+			mcp.Description("Include a table of contents"),
+		),
+		mcp.WithNumber("toc_depth",
+			mcp.Description("Number of heading levels in the table of contents"),
+			mcp.Min(1),
+			mcp.Max(6),
+		),
+		mcp.WithBoolean("standalone",
+			mcp.Description("Produce a complete document with header and footer (e.g. full HTML page) instead of a fragment"),
+		),
+		mcp.WithBoolean("number_sections",
+			mcp.Description("Number section headings"),
+		),
+		mcp.WithObject("metadata",
+			mcp.Description("Document metadata such as title, author, date, lang"),
+			mcp.AdditionalProperties(map[string]any{"type": []string{"string", "number", "boolean"}}),
+		),
+		mcp.WithObject("variables",
+			mcp.Description("Template variables, e.g. {\"geometry\": \"margin=2cm\", \"fontsize\": \"12pt\"}"),
+			mcp.AdditionalProperties(map[string]any{"type": []string{"string", "number", "boolean"}}),
+		),
+		mcp.WithBoolean("allow_remote_resources",
+			mcp.Description("Let pandoc fetch remote images (http/https) referenced by the document; only honoured if the server allows remote resources"),
+		),
+		mcp.WithBoolean("no_cache",
+			mcp.Description("Run pandoc even if the same conversion is cached; use when images or other files referenced by the document changed"),
+		),
+		mcp.WithString("highlight_style",
+			mcp.Description("Syntax highlighting style, e.g. pygments, tango, kate, monochrome, breezedark"),
+		),
+		mcp.WithString("wrap",
+			mcp.Description("Text wrapping in the output"),
+			mcp.Enum("auto", "none", "preserve"),
+		),
+		mcp.WithNumber("columns",
+			mcp.Description("Line length for wrapping"),
+			mcp.Min(1),
+			mcp.Max(1000),
+		),
+		mcp.WithString("eol",
+			mcp.Description("Line endings of the output"),
+			mcp.Enum("crlf", "lf", "native"),
+		),
+		mcp.WithNumber("shift_heading_level",
+			mcp.Description("Shift heading levels by this amount (e.g. 1 turns # into ##)"),
+			mcp.Min(-5),
+			mcp.Max(5),
+		),
+	}
 
 	// Register convert_contents tool
-	convertTool := mcp.NewTool("convert_contents",
+	convertArgs := []mcp.ToolOption{
 		mcp.WithDescription("Convert document between different formats using Pandoc"),
 		mcp.WithString("contents",
-			mcp.Description("Source content to convert (required if input_file not provided)"),
+			mcp.Description("Source content to convert as text (one of contents, contents_base64, contents_resource or input_file is required)"),
+		),
+		mcp.WithString("contents_base64",
+			mcp.Description("Base64-encoded source document, for binary inputs such as docx, epub or odt held by the client"),
+		),
+		mcp.WithObject("contents_resource",
+			mcp.Description("Source document as embedded resource contents: {\"uri\", \"mimeType\", \"blob\"} with base64 data or {\"uri\", \"mimeType\", \"text\"}; the uri file name and mimeType help detect the input format"),
+			mcp.Properties(map[string]any{
+				"uri":      map[string]any{"type": "string"},
+				"mimeType": map[string]any{"type": "string"},
+				"blob":     map[string]any{"type": "string"},
+				"text":     map[string]any{"type": "string"},
+			}),
 		),
 		mcp.WithString("input_file",
 			mcp.Description("Complete path to input file (required if contents not provided)"),
 		),
 		mcp.WithString("input_format",
-			mcp.Description("Source format of the content"),
-			mcp.DefaultString("markdown"),
-			mcp.Enum("markdown", "html", "pdf", "docx", "rst", "latex", "epub", "txt"),
+			mcp.Description("Source format of the content (inferred from input_file extension or content when omitted, markdown by default)"),
+			mcp.Enum(capabilities.InputNames()...),
 		),
 		mcp.WithString("output_format",
-			mcp.Description("Target format"),
-			mcp.DefaultString("markdown"),
-			mcp.Enum("markdown", "html", "pdf", "docx", "rst", "latex", "epub", "txt"),
+			mcp.Description("Target format (inferred from output_file extension when omitted, markdown by default)"),
+			mcp.Enum(capabilities.OutputNames()...),
 		),
 		mcp.WithString("output_file",
-			mcp.Description("Complete path for output file (required for pdf, docx, rst, latex, epub formats)"),
+			mcp.Description("Complete path for output file (required for output_mode file and both)"),
 		),
-	)
+		mcp.WithString("output_mode",
+			mcp.Description("file: write output_file and return its path; inline: return the document as an embedded resource (base64 blob for pdf, docx, epub, ...); both: do both. Defaults to file when output_file is given, inline for binary formats otherwise"),
+			mcp.Enum("file", "inline", "both"),
+		),
+	}
+	convertTool := mcp.NewTool("convert_contents", append(convertArgs, optionArgs...)...)
 
 	// Add tool handler
-	s.AddTool(convertTool, tools.ConvertContentsHandler)
+	handler := tools.NewHandler(converter, policy)
+	s.AddTool(convertTool, handler.ConvertContents)
+
+	// Register convert_batch tool
+	batchArgs := []mcp.ToolOption{
+		mcp.WithDescription("Convert many files in one call, given as a list of jobs or as a glob with an output directory; returns the outcome of every file (success, output file, warnings, duration) instead of stopping at the first failure"),
+		mcp.WithArray("jobs",
+			mcp.Description("Conversions to run: [{\"input_file\", \"output_file\", \"input_format\", \"output_format\", \"options\"}]; options holds convert_contents options overriding the batch options for this job"),
+			mcp.Items(map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"input_file":    map[string]any{"type": "string"},
+					"output_file":   map[string]any{"type": "string"},
+					"input_format":  map[string]any{"type": "string"},
+					"output_format": map[string]any{"type": "string"},
+					"options":       map[string]any{"type": "object"},
+				},
+				"required": []string{"input_file", "output_file"},
+			}),
+		),
+		mcp.WithString("glob",
+			mcp.Description("Input files to convert instead of jobs, e.g. docs/**/*.md; ** matches any number of directories"),
+		),
+		mcp.WithString("output_dir",
+			mcp.Description("Directory the files matched by glob are written to, keeping their paths relative to the directory before the first wildcard"),
+		),
+		mcp.WithObject("extensions",
+			mcp.Description("Output extension for each input extension of files matched by glob, e.g. {\"md\": \"html\", \"rst\": \"html\"}; defaults to the extension of output_format"),
+			mcp.AdditionalProperties(map[string]any{"type": "string"}),
+		),
+		mcp.WithString("input_format",
+			mcp.Description("Source format of every file (inferred from each file when omitted)"),
+			mcp.Enum(capabilities.InputNames()...),
+		),
+		mcp.WithString("output_format",
+			mcp.Description("Target format of every file (inferred from each output file extension when omitted)"),
+			mcp.Enum(capabilities.OutputNames()...),
+		),
+		mcp.WithNumber("max_parallel",
+			mcp.Description("Number of files converted at once (default 4)"),
+			mcp.Min(1),
+			mcp.Max(16),
+		),
+	}
+	batchTool := mcp.NewTool("convert_batch", append(batchArgs, optionArgs...)...)
+	s.AddTool(batchTool, handler.ConvertBatch)
+
+	// Register convert_directory tool
+	directoryArgs := []mcp.ToolOption{
+		mcp.WithDescription("Convert the documents of a directory tree into a mirrored output tree, copying the images and other files they reference and rewriting links such as other.md#anchor to other.html#anchor"),
+		mcp.WithString("source_dir",
+			mcp.Required(),
+			mcp.Description("Directory to convert; hidden files and directories are skipped"),
+		),
+		mcp.WithString("output_dir",
+			mcp.Required(),
+			mcp.Description("Directory the converted tree is written to"),
+		),
+		mcp.WithArray("include",
+			mcp.Description("Patterns of the documents to convert, relative to source_dir (default [\"**/*.md\", \"**/*.markdown\"]); ** matches any number of directories"),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithString("input_format",
+			mcp.Description("Source format of every document (inferred from each file when omitted)"),
+			mcp.Enum(capabilities.InputNames()...),
+		),
+		mcp.WithString("output_format",
+			mcp.Description("Target format (default html)"),
+			mcp.Enum(capabilities.OutputNames()...),
+		),
+		mcp.WithString("output_extension",
+			mcp.Description("Extension of the converted files and of rewritten links (default: the extension of output_format)"),
+		),
+		mcp.WithNumber("max_parallel",
+			mcp.Description("Number of documents converted at once (default 4)"),
+			mcp.Min(1),
+			mcp.Max(16),
+		),
+	}
+	directoryTool := mcp.NewTool("convert_directory", append(directoryArgs, optionArgs...)...)
+	s.AddTool(directoryTool, handler.ConvertDirectory)
+
+	// Register build_book tool
+	bookArgs := []mcp.ToolOption{
+		mcp.WithDescription("Assemble chapter files, listed in order or by a manifest YAML, into one pdf, docx, epub or html book with chapter breaks, a table of contents and a single title and author"),
+		mcp.WithArray("chapters",
+			mcp.Description("Chapter files in reading order"),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithString("manifest",
+			mcp.Description("YAML manifest with title, author (string or list), cover_image and chapters; its relative paths are resolved against the manifest directory"),
+		),
+		mcp.WithString("title",
+			mcp.Description("Book title, replacing the manifest title and the titles of the chapters"),
+		),
+		mcp.WithArray("authors",
+			mcp.Description("Book authors, replacing the manifest authors"),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithString("cover_image",
+			mcp.Description("Cover image: the EPUB cover, or a page before the first chapter in other formats"),
+		),
+		mcp.WithString("input_format",
+			mcp.Description("Source format of the chapters (inferred from the first chapter when omitted)"),
+			mcp.Enum(capabilities.InputNames()...),
+		),
+		mcp.WithString("output_format",
+			mcp.Description("Target format, e.g. pdf, docx, epub or html (inferred from output_file extension when omitted)"),
+			mcp.Enum(capabilities.OutputNames()...),
+		),
+		mcp.WithString("output_file",
+			mcp.Required(),
+			mcp.Description("Complete path for the book"),
+		),
+	}
+	bookTool := mcp.NewTool("build_book", append(bookArgs, optionArgs...)...)
+	s.AddTool(bookTool, handler.BuildBook)
+
+	// Register list_templates tool
+	listTemplatesTool := mcp.NewTool("list_templates",
+		mcp.WithDescription("List named templates (reference documents, pandoc templates, CSS) usable with the template argument of convert_contents"),
+		mcp.WithReadOnlyHintAnnotation(true),
+	)
+	s.AddTool(listTemplatesTool, tools.NewTemplatesHandler(converter.Templates()).ListTemplates)
+
+	// Register list_formats tool
+	formatsHandler := tools.NewFormatsHandler(converter.Capabilities)
+	listFormatsTool := mcp.NewTool("list_formats",
+		mcp.WithDescription("List the input and output formats and the format extensions supported by the installed pandoc"),
+		mcp.WithReadOnlyHintAnnotation(true),
+	)
+	s.AddTool(listFormatsTool, formatsHandler.ListFormats)
+
+	// Register cache tools
+	cacheHandler := tools.NewCacheHandler(converter.Cache())
+	if cache := converter.Cache(); cache != nil {
+		logger.Info("Conversion cache at %s", cache.Dir())
+	}
+	cacheStatsTool := mcp.NewTool("cache_stats",
+		mcp.WithDescription("Show the number, size and hit rate of cached conversions"),
+		mcp.WithReadOnlyHintAnnotation(true),
+	)
+	s.AddTool(cacheStatsTool, cacheHandler.CacheStats)
+	clearCacheTool := mcp.NewTool("clear_cache",
+		mcp.WithDescription("Remove every cached conversion"),
+		mcp.WithDestructiveHintAnnotation(true),
+	)
+	s.AddTool(clearCacheTool, cacheHandler.ClearCache)
+
+	// Завершаем работу по SIGTERM/SIGINT
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-sigChan
+		cancel()
+	}()
+
+	roots := tools.NewRootsClient(policy)
 
 	// Start server via stdio
+	stdio := server.NewStdioServer(s)
+	stdio.SetErrorLogger(log.New(os.Stderr, "", log.LstdFlags))
+
 	logger.Info("Server initialized, waiting for requests...")
-	if err := server.ServeStdio(s); err != nil {
+	// Уведомления об отмене читаются из stdin сразу, не дожидаясь окончания текущей конвертации
+	input := roots.WatchInput(cancellations.WatchInput(os.Stdin))
+	if err := stdio.Listen(ctx, input, roots.Output(os.Stdout)); err != nil && err != context.Canceled {
 		logger.Error("Server error: %v", err)
 		os.Exit(1)
 	}
@@ -4,7 +4,10 @@ go 1.23
 
 toolchain go1.23.9
 
-require github.com/mark3labs/mcp-go v0.28.0
+require (
+	github.com/mark3labs/mcp-go v0.28.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/google/uuid v1.6.0 // indirect
@@ -75,6 +75,11 @@ func (l *Logger) Info(format string, v ...interface{}) {
 	l.write("INFO", format, v...)
 }
 
+// Warn логирует предупреждение
+func (l *Logger) Warn(format string, v ...interface{}) {
+	l.write("WARN", format, v...)
+}
+
 // Error логирует сообщение об ошибке
 func (l *Logger) Error(format string, v ...interface{}) {
 	l.write("ERROR", format, v...)
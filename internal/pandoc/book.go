@@ -0,0 +1,127 @@
+package pandoc
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ChapterBreaksFilter is the built-in filter starting chapters on new pages
+const ChapterBreaksFilter = "chapter-breaks"
+
+// Book is a document assembled from chapter files
+type Book struct {
+	Title      string
+	Authors    []string
+	Chapters   []string
+	CoverImage string
+}
+
+// bookManifest is the YAML form of a Book
+type bookManifest struct {
+	Title  string `yaml:"title"`
+	Author any    `yaml:"author"`
+	// Authors is accepted as a synonym of author
+	Authors    any      `yaml:"authors"`
+	Chapters   []string `yaml:"chapters"`
+	CoverImage string   `yaml:"cover_image"`
+	// Cover is accepted as a synonym of cover_image, as in pandoc metadata
+	Cover string `yaml:"cover-image"`
+}
+
+// LoadBook reads a book manifest such as
+//
+//	title: User Manual
+//	author: [Jane Doe, John Roe]
+//	cover_image: images/cover.png
+//	chapters:
+//	  - intro.md
+//	  - install.md
+//
+// Relative paths are resolved against the directory of the manifest.
+func LoadBook(path string) (*Book, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, &InputNotFoundError{Path: path}
+		}
+		return nil, fmt.Errorf("failed to read book manifest: %v", err)
+	}
+
+	var manifest bookManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, &ArgumentError{Argument: "manifest", Reason: fmt.Sprintf("invalid YAML: %v", err)}
+	}
+
+	book := &Book{Title: manifest.Title, CoverImage: manifest.CoverImage}
+	if book.CoverImage == "" {
+		book.CoverImage = manifest.Cover
+	}
+	authors := manifest.Author
+	if authors == nil {
+		authors = manifest.Authors
+	}
+	if book.Authors, err = manifestStrings(authors); err != nil {
+		return nil, &ArgumentError{Argument: "manifest", Reason: "author " + err.Error()}
+	}
+
+	dir := filepath.Dir(path)
+	resolve := func(file string) string {
+		file = normalizePath(file)
+		if file == "" || filepath.IsAbs(file) {
+			return file
+		}
+		return filepath.Join(dir, file)
+	}
+	for _, chapter := range manifest.Chapters {
+		if chapter == "" {
+			return nil, &ArgumentError{Argument: "manifest", Reason: "chapters must not be empty strings"}
+		}
+		book.Chapters = append(book.Chapters, resolve(chapter))
+	}
+	book.CoverImage = resolve(book.CoverImage)
+	return book, nil
+}
+
+// manifestStrings reads a manifest field that is a string or a list of strings
+func manifestStrings(value any) ([]string, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{value}, nil
+	case []any:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, errors.New("must be a string or a list of strings")
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	default:
+		return nil, errors.New("must be a string or a list of strings")
+	}
+}
+
+// coverArgs returns the arguments placing opts.CoverImage: the cover-image
+// metadata field, which the chapter-breaks filter turns into a cover page
+// and loads for the writers, and for EPUB its own cover option
+func coverArgs(opts Options, outputFormat string) []string {
+	if opts.CoverImage == "" {
+		return nil
+	}
+	args := []string{"--metadata", "cover-image=" + opts.CoverImage}
+	if epubFormats[LookupFormat(outputFormat).Name] {
+		args = append(args, "--epub-cover-image="+opts.CoverImage)
+	}
+	return args
+}
+
+// epubFormats are the output formats with a native cover image
+var epubFormats = map[string]bool{"epub": true, "epub2": true, "epub3": true}
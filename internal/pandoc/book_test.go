@@ -0,0 +1,80 @@
+package pandoc
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeCover writes a PNG image to path that differs from the ones writePNG
+// writes, and returns its contents
+func writeCover(t *testing.T, path string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestBookCover(t *testing.T) {
+	for _, sandbox := range []string{"on", "off"} {
+		for _, format := range []string{"docx", "epub"} {
+			t.Run("sandbox "+sandbox+" "+format, func(t *testing.T) {
+				converter := newTestConverter(t, map[string]string{"PANDOC_SANDBOX": sandbox})
+				dir := t.TempDir()
+				chaptersDir := filepath.Join(dir, "chapters")
+				if err := os.Mkdir(chaptersDir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				cover := writeCover(t, filepath.Join(dir, "cover.png"))
+				writePNG(t, filepath.Join(chaptersDir, "figure.png"))
+				figure, err := os.ReadFile(filepath.Join(chaptersDir, "figure.png"))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				chapters := []string{filepath.Join(chaptersDir, "one.md"), filepath.Join(chaptersDir, "two.md")}
+				if err := os.WriteFile(chapters[0], []byte("# One\n\n![figure](figure.png)\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(chapters[1], []byte("# Two\n\ntext\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+
+				outputFile := filepath.Join(t.TempDir(), "book."+format)
+				opts := Options{
+					Standalone:       true,
+					FileScope:        true,
+					TopLevelDivision: "chapter",
+					Filters:          []string{ChapterBreaksFilter},
+					CoverImage:       filepath.Join(dir, "cover.png"),
+					ResourcePath:     []string{chaptersDir, dir},
+					Metadata:         map[string]string{"title": "Book"},
+				}
+				if _, err := converter.ConvertFiles(context.Background(), chapters, "markdown", format, outputFile, opts); err != nil {
+					t.Fatal(err)
+				}
+
+				var hasCover, hasFigure bool
+				for _, data := range zipEntries(t, outputFile) {
+					hasCover = hasCover || bytes.Equal(data, cover)
+					hasFigure = hasFigure || bytes.Equal(data, figure)
+				}
+				if !hasCover {
+					t.Errorf("%s has no cover image", format)
+				}
+				if !hasFigure {
+					t.Errorf("%s lost the chapter image", format)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package pandoc
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// brandingFilter adds the rendered branding to the document
+//
+//go:embed lua/branding.lua
+var brandingFilter []byte
+
+// BrandingMode selects where branding content comes from
+type BrandingMode string
+
+const (
+	// BrandingNone disables branding
+	BrandingNone BrandingMode = "none"
+	// BrandingText uses the text from PANDOC_BRANDING_TEXT
+	BrandingText BrandingMode = "text"
+	// BrandingFile uses the contents of PANDOC_BRANDING_FILE as is
+	BrandingFile BrandingMode = "file"
+	// BrandingTemplate renders PANDOC_BRANDING_FILE as a Go template
+	BrandingTemplate BrandingMode = "template"
+)
+
+// Branding positions
+const (
+	BrandingFooter = "footer"
+	BrandingHeader = "header"
+)
+
+// defaultBrandingFile is the branding file used when PANDOC_BRANDING_FILE is unset
+var defaultBrandingFile = filepath.Join("templates", "footer.md")
+
+// BrandingConfig describes the header or footer added to converted documents
+type BrandingConfig struct {
+	Mode     BrandingMode
+	Position string
+	Text     string
+	File     string
+	Author   string
+	Project  string
+	// EnabledByDefault applies branding to requests that don't opt in or out
+	EnabledByDefault bool
+}
+
+// BrandingVariables are available in branding templates
+type BrandingVariables struct {
+	Date    string
+	Year    int
+	Author  string
+	Project string
+}
+
+// BrandingFromEnv reads the deployment branding configuration:
+//
+//	PANDOC_BRANDING          none (default), text, file or template
+//	PANDOC_BRANDING_TEXT     markdown text for the text mode
+//	PANDOC_BRANDING_FILE     markdown file or template (default templates/footer.md)
+//	PANDOC_BRANDING_POSITION footer (default) or header
+//	PANDOC_BRANDING_AUTHOR   {{.Author}} template variable
+//	PANDOC_BRANDING_PROJECT  {{.Project}} template variable
+//	PANDOC_BRANDING_DEFAULT  on (default) or off; off applies branding only on request
+func BrandingFromEnv() BrandingConfig {
+	cfg := BrandingConfig{
+		Mode:             BrandingMode(strings.ToLower(strings.TrimSpace(os.Getenv("PANDOC_BRANDING")))),
+		Position:         strings.ToLower(strings.TrimSpace(os.Getenv("PANDOC_BRANDING_POSITION"))),
+		Text:             os.Getenv("PANDOC_BRANDING_TEXT"),
+		File:             os.Getenv("PANDOC_BRANDING_FILE"),
+		Author:           os.Getenv("PANDOC_BRANDING_AUTHOR"),
+		Project:          os.Getenv("PANDOC_BRANDING_PROJECT"),
+		EnabledByDefault: !strings.EqualFold(strings.TrimSpace(os.Getenv("PANDOC_BRANDING_DEFAULT")), "off"),
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = BrandingNone
+	}
+	if cfg.Position != BrandingHeader {
+		cfg.Position = BrandingFooter
+	}
+	if cfg.File == "" {
+		cfg.File = dataPath(defaultBrandingFile)
+	}
+	return cfg
+}
+
+// Enabled decides whether branding applies to a request. requested is the
+// per-request choice, nil when the client did not specify one.
+func (b BrandingConfig) Enabled(requested *bool) bool {
+	if b.Mode == BrandingNone || b.Mode == "" {
+		return false
+	}
+	if requested != nil {
+		return *requested
+	}
+	return b.EnabledByDefault
+}
+
+// Render returns the branding as markdown
+func (b BrandingConfig) Render(now time.Time) (string, error) {
+	switch b.Mode {
+	case BrandingNone, "":
+		return "", nil
+	case BrandingText:
+		return b.Text, nil
+	case BrandingFile:
+		content, err := os.ReadFile(b.File)
+		if err != nil {
+			return "", fmt.Errorf("failed to read branding file: %v", err)
+		}
+		return string(content), nil
+	case BrandingTemplate:
+		content, err := os.ReadFile(b.File)
+		if err != nil {
+			return "", fmt.Errorf("failed to read branding template: %v", err)
+		}
+		tmpl, err := template.New(filepath.Base(b.File)).Parse(string(content))
+		if err != nil {
+			return "", fmt.Errorf("invalid branding template %s: %v", b.File, err)
+		}
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, BrandingVariables{
+			Date:    now.Format("2006-01-02"),
+			Year:    now.Year(),
+			Author:  b.Author,
+			Project: b.Project,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to render branding template: %v", err)
+		}
+		return buf.String(), nil
+	default:
+		return "", fmt.Errorf("unknown branding mode: %s", b.Mode)
+	}
+}
+
+// brandingArgs returns the pandoc arguments that add branding to the output,
+// writing the branding filter to workDir
+func (p *PandocConverter) brandingArgs(requested *bool, workDir string) ([]string, error) {
+	if !p.branding.Enabled(requested) {
+		return nil, nil
+	}
+
+	text, err := p.branding.Render(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+
+	filterPath, err := writeWorkFile(workDir, "branding-*.lua", brandingFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"--metadata", "branding-" + p.branding.Position + "=" + text,
+		"--lua-filter", filterPath,
+	}
+	return args, nil
+}
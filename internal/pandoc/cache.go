@@ -0,0 +1,421 @@
+package pandoc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache defaults
+const (
+	DefaultCacheMaxBytes = 256 << 20
+	DefaultCacheTTL      = 24 * time.Hour
+)
+
+// cacheSweepInterval bounds how long entries nobody asks for again outlive
+// their TTL: put scans the cache directory at most this often, unless the
+// size tracked in memory exceeds the limit first
+const cacheSweepInterval = 10 * time.Minute
+
+// cacheKeyVersion changes whenever the key derivation changes
+const cacheKeyVersion = "2"
+
+// Files of a cache entry: the converted document and its metadata. The
+// metadata is written last, so an entry without it is incomplete.
+const (
+	cacheDataExt = ".out"
+	cacheMetaExt = ".json"
+)
+
+// Cache stores converted documents on disk under a hash of everything that
+// determines pandoc's output, so repeated conversions return without running
+// pandoc. Entries expire when unused for the TTL, and the least recently used
+// are removed when the cache outgrows its size limit.
+type Cache struct {
+	dir      string
+	maxBytes int64
+	ttl      time.Duration
+
+	mu sync.Mutex
+	// size is the total size of the entries as of the last sweep, plus the
+	// entries stored and minus those removed since then
+	size      int64
+	lastSweep time.Time
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+// cacheEntry is the metadata of a cached document
+type cacheEntry struct {
+	Created  time.Time `json:"created"`
+	Size     int64     `json:"size"`
+	Warnings []Warning `json:"warnings,omitempty"`
+}
+
+// CacheStats describes the cache contents and its use since the server started
+type CacheStats struct {
+	Enabled   bool   `json:"enabled"`
+	Dir       string `json:"dir,omitempty"`
+	Entries   int    `json:"entries"`
+	SizeBytes int64  `json:"size_bytes"`
+	MaxBytes  int64  `json:"max_bytes,omitempty"`
+	TTL       string `json:"ttl,omitempty"`
+	Hits      int64  `json:"hits"`
+	Misses    int64  `json:"misses"`
+	Evictions int64  `json:"evictions"`
+}
+
+// NewCache creates a cache in dir
+func NewCache(dir string, maxBytes int64, ttl time.Duration) *Cache {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return &Cache{dir: dir, maxBytes: maxBytes, ttl: ttl}
+}
+
+// CacheFromEnv creates the cache configured by PANDOC_CACHE (off by default,
+// as cached documents stay on disk in plain text), PANDOC_CACHE_DIR
+// (default: mcp-pandoc in the user cache directory), PANDOC_CACHE_MAX_BYTES
+// and PANDOC_CACHE_TTL. It returns nil when caching is off.
+func CacheFromEnv() *Cache {
+	if !envBool("PANDOC_CACHE", false) {
+		return nil
+	}
+
+	dir := os.Getenv("PANDOC_CACHE_DIR")
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			base = os.TempDir()
+		}
+		dir = filepath.Join(base, "mcp-pandoc")
+	}
+
+	maxBytes := int64(DefaultCacheMaxBytes)
+	if n, err := strconv.ParseInt(os.Getenv("PANDOC_CACHE_MAX_BYTES"), 10, 64); err == nil && n > 0 {
+		maxBytes = n
+	}
+	ttl := DefaultCacheTTL
+	if d, err := time.ParseDuration(os.Getenv("PANDOC_CACHE_TTL")); err == nil && d > 0 {
+		ttl = d
+	}
+
+	return NewCache(dir, maxBytes, ttl)
+}
+
+// Dir returns the cache directory
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// get returns the cached document and its metadata, updating its access time
+func (c *Cache) get(key string) ([]byte, *cacheEntry, bool) {
+	dataPath, metaPath := c.paths(key)
+
+	var entry *cacheEntry
+	info, err := os.Stat(metaPath)
+	if err == nil && time.Since(info.ModTime()) > c.ttl {
+		c.grow(-c.remove(key))
+		err = fs.ErrNotExist
+	}
+	if err == nil {
+		entry, err = readCacheEntry(metaPath)
+	}
+	var data []byte
+	if err == nil {
+		data, err = os.ReadFile(dataPath)
+	}
+	if err != nil || int64(len(data)) != entry.Size {
+		c.count(&c.misses)
+		return nil, nil, false
+	}
+
+	// The modification time of the metadata records the last use
+	now := time.Now()
+	os.Chtimes(metaPath, now, now)
+	c.count(&c.hits)
+	return data, entry, true
+}
+
+// put stores a converted document and evicts old entries if the cache grew
+// beyond its limit or was not swept for cacheSweepInterval
+func (c *Cache) put(key string, data []byte, warnings []Warning) error {
+	if int64(len(data)) > c.maxBytes {
+		return nil
+	}
+	dataPath, metaPath := c.paths(key)
+	if err := os.MkdirAll(filepath.Dir(dataPath), 0700); err != nil {
+		return err
+	}
+
+	meta, err := json.Marshal(cacheEntry{Created: time.Now(), Size: int64(len(data)), Warnings: warnings})
+	if err != nil {
+		return err
+	}
+	replaced := c.entrySize(key)
+	if err := writeFileAtomic(dataPath, data); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(metaPath, meta); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.size += int64(len(data)+len(meta)) - replaced
+	sweep := c.size > c.maxBytes || time.Since(c.lastSweep) > cacheSweepInterval
+	c.mu.Unlock()
+	if sweep {
+		c.evict()
+	}
+	return nil
+}
+
+// Stats returns the cache statistics
+func (c *Cache) Stats() CacheStats {
+	stats := CacheStats{
+		Enabled:  true,
+		Dir:      c.dir,
+		MaxBytes: c.maxBytes,
+		TTL:      c.ttl.String(),
+	}
+	for _, e := range c.entries() {
+		stats.Entries++
+		stats.SizeBytes += e.size
+	}
+
+	c.mu.Lock()
+	stats.Hits, stats.Misses, stats.Evictions = c.hits, c.misses, c.evictions
+	c.mu.Unlock()
+	return stats
+}
+
+// Clear removes every entry and returns how many there were. Only entry
+// files are deleted, in case the cache directory is shared with other files.
+func (c *Cache) Clear() int {
+	entries := c.entries()
+	for _, e := range entries {
+		c.grow(-c.remove(e.key))
+		// Fails harmlessly while the subdirectory still holds other entries
+		os.Remove(filepath.Join(c.dir, e.key[:2]))
+	}
+	return len(entries)
+}
+
+// storedEntry is an entry found on disk
+type storedEntry struct {
+	key      string
+	size     int64
+	lastUsed time.Time
+}
+
+// entries lists the complete entries on disk
+func (c *Cache) entries() []storedEntry {
+	var entries []storedEntry
+	filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != cacheMetaExt {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		key := strings.TrimSuffix(d.Name(), cacheMetaExt)
+		size := info.Size()
+		if dataInfo, err := os.Stat(filepath.Join(filepath.Dir(path), key+cacheDataExt)); err == nil {
+			size += dataInfo.Size()
+		}
+		entries = append(entries, storedEntry{key: key, size: size, lastUsed: info.ModTime()})
+		return nil
+	})
+	return entries
+}
+
+// evict removes expired entries, then the least recently used ones until
+// the cache fits its size limit, and resets the size tracked in memory to
+// what is left on disk
+func (c *Cache) evict() {
+	entries := c.entries()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUsed.Before(entries[j].lastUsed)
+	})
+
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+	for _, e := range entries {
+		if total <= c.maxBytes && time.Since(e.lastUsed) <= c.ttl {
+			continue
+		}
+		c.remove(e.key)
+		total -= e.size
+		c.count(&c.evictions)
+	}
+
+	c.mu.Lock()
+	c.size, c.lastSweep = total, time.Now()
+	c.mu.Unlock()
+}
+
+// remove deletes an entry, metadata first so readers never see half of it,
+// and returns the bytes it took
+func (c *Cache) remove(key string) int64 {
+	size := c.entrySize(key)
+	dataPath, metaPath := c.paths(key)
+	os.Remove(metaPath)
+	os.Remove(dataPath)
+	return size
+}
+
+// entrySize returns the bytes the files of key take, 0 if there are none
+func (c *Cache) entrySize(key string) int64 {
+	var size int64
+	dataPath, metaPath := c.paths(key)
+	for _, path := range []string{dataPath, metaPath} {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// grow adds delta to the size tracked in memory
+func (c *Cache) grow(delta int64) {
+	c.mu.Lock()
+	c.size += delta
+	c.mu.Unlock()
+}
+
+// paths returns the data and metadata files of key, spread over
+// subdirectories named after the first two hex digits
+func (c *Cache) paths(key string) (string, string) {
+	base := filepath.Join(c.dir, key[:2], key)
+	return base + cacheDataExt, base + cacheMetaExt
+}
+
+// count increments one of the statistics counters
+func (c *Cache) count(counter *int64) {
+	c.mu.Lock()
+	*counter++
+	c.mu.Unlock()
+}
+
+// readCacheEntry reads the metadata of an entry
+func readCacheEntry(path string) (*cacheEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// writeFileAtomic writes data to a temporary file renamed to path, so
+// concurrent readers see the old or the new file, never a partial one
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// cacheKey hashes everything that determines pandoc's output: the pandoc
+// version, the formats, the request arguments, the contents of the files the
+// server resolved for them, and the input. Only files the server chose are
+// read; values a client passes through, such as metadata, are hashed as
+// text. Files in workDir get random names, so only their contents are hashed.
+func cacheKey(version, inputFormat, outputFormat string, args, files []string, workDir string, content []byte, inputFiles []string) (string, error) {
+	h := sha256.New()
+	writeKeyPart(h, cacheKeyVersion)
+	writeKeyPart(h, version)
+	writeKeyPart(h, inputFormat)
+	writeKeyPart(h, outputFormat)
+
+	for _, arg := range args {
+		// Built-in filters and inline references written to workDir, named
+		// by the argument or by the value of --flag=value
+		value := arg
+		if i := strings.IndexByte(arg, '='); i >= 0 {
+			value = arg[i+1:]
+		}
+		if !inDir(value, workDir) {
+			writeKeyPart(h, arg)
+			continue
+		}
+		writeKeyPart(h, strings.TrimSuffix(arg, value)+"$WORKFILE")
+		if err := hashFile(h, value); err != nil {
+			return "", err
+		}
+	}
+
+	for _, file := range files {
+		if inDir(file, workDir) {
+			continue
+		}
+		// A missing file is left for pandoc to report
+		if err := hashFile(h, file); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	for _, inputFile := range inputFiles {
+		if err := hashFile(h, inputFile); err != nil {
+			return "", err
+		}
+	}
+	if len(inputFiles) == 0 {
+		writeKeyPart(h, string(content))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// inDir checks if path is a file inside dir
+func inDir(path, dir string) bool {
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// writeKeyPart adds a length-prefixed part to the key, so parts cannot run
+// into each other
+func writeKeyPart(h hash.Hash, part string) {
+	fmt.Fprintf(h, "%d:%s\n", len(part), part)
+}
+
+// hashFile adds the contents of path to the key
+func hashFile(h hash.Hash, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fileHash := sha256.New()
+	if _, err := io.Copy(fileHash, f); err != nil {
+		return err
+	}
+	writeKeyPart(h, hex.EncodeToString(fileHash.Sum(nil)))
+	return nil
+}
@@ -0,0 +1,190 @@
+package pandoc
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// keyFixture holds the files a cache key is derived from
+type keyFixture struct {
+	workDir, template, input string
+}
+
+func newKeyFixture(t *testing.T) keyFixture {
+	t.Helper()
+	dir := t.TempDir()
+	f := keyFixture{
+		workDir:  filepath.Join(dir, "work"),
+		template: filepath.Join(dir, "template.html"),
+		input:    filepath.Join(dir, "doc.md"),
+	}
+	if err := os.Mkdir(f.workDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(f.workDir, "filter-1.lua"), "-- filter")
+	writeTestFile(t, f.template, "$body$")
+	writeTestFile(t, f.input, "# Title")
+	return f
+}
+
+// writeTestFile creates path with content
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// key derives the cache key of a conversion of content, or of inputFiles,
+// with args and the resolved files
+func (f keyFixture) key(t *testing.T, args, files []string, content string, inputFiles ...string) string {
+	t.Helper()
+	key, err := cacheKey("3.1", "markdown", "html", args, files, f.workDir, []byte(content), inputFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestCacheKey(t *testing.T) {
+	f := newKeyFixture(t)
+	filterArgs := func(name string) []string {
+		return []string{"--lua-filter", filepath.Join(f.workDir, name), "--template=" + f.template}
+	}
+	base := f.key(t, filterArgs("filter-1.lua"), []string{f.template}, "# Title")
+
+	if again := f.key(t, filterArgs("filter-1.lua"), []string{f.template}, "# Title"); again != base {
+		t.Error("key changed between identical conversions")
+	}
+
+	// Work files get random names; only their contents count
+	writeTestFile(t, filepath.Join(f.workDir, "filter-2.lua"), "-- filter")
+	if renamed := f.key(t, filterArgs("filter-2.lua"), []string{f.template}, "# Title"); renamed != base {
+		t.Error("key depends on the name of a work file")
+	}
+	writeTestFile(t, filepath.Join(f.workDir, "filter-3.lua"), "-- other filter")
+	if changed := f.key(t, filterArgs("filter-3.lua"), []string{f.template}, "# Title"); changed == base {
+		t.Error("key ignores the contents of a work file")
+	}
+
+	if withArg := f.key(t, append(filterArgs("filter-1.lua"), "--toc"), []string{f.template}, "# Title"); withArg == base {
+		t.Error("key ignores an added argument")
+	}
+	if withContent := f.key(t, filterArgs("filter-1.lua"), []string{f.template}, "# Other"); withContent == base {
+		t.Error("key ignores the content")
+	}
+
+	writeTestFile(t, f.template, "<main>$body$</main>")
+	if edited := f.key(t, filterArgs("filter-1.lua"), []string{f.template}, "# Title"); edited == base {
+		t.Error("key ignores a change of a resolved file")
+	}
+
+	missing := filepath.Join(filepath.Dir(f.template), "missing.csl")
+	if _, err := cacheKey("3.1", "markdown", "html", nil, []string{missing}, f.workDir, nil, nil); err != nil {
+		t.Errorf("missing resolved file: %v, want it left to pandoc", err)
+	}
+
+	fileKey := f.key(t, nil, nil, "", f.input)
+	writeTestFile(t, f.input, "# Edited")
+	if edited := f.key(t, nil, nil, "", f.input); edited == fileKey {
+		t.Error("key ignores a change of the input file")
+	}
+}
+
+// testKey returns a cache key naming entry n
+func testKey(n byte) string {
+	return string(bytes.Repeat([]byte{"0123456789abcdef"[n]}, 64))
+}
+
+// ageEntry makes key look unused since age ago
+func ageEntry(t *testing.T, c *Cache, key string, age time.Duration) {
+	t.Helper()
+	_, metaPath := c.paths(key)
+	when := time.Now().Add(-age)
+	if err := os.Chtimes(metaPath, when, when); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	c := NewCache(t.TempDir(), 1<<20, time.Hour)
+	if err := c.put(testKey(1), []byte("document"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _, ok := c.get(testKey(1)); !ok || string(data) != "document" {
+		t.Fatalf("get() = %q, %v, want the stored document", data, ok)
+	}
+
+	ageEntry(t, c, testKey(1), 2*time.Hour)
+	if _, _, ok := c.get(testKey(1)); ok {
+		t.Error("expired entry was returned")
+	}
+	dataPath, _ := c.paths(testKey(1))
+	if _, err := os.Stat(dataPath); !os.IsNotExist(err) {
+		t.Error("expired entry was left on disk")
+	}
+	if stats := c.Stats(); stats.Entries != 0 || stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("stats = %+v, want no entries, 1 hit and 1 miss", stats)
+	}
+}
+
+func TestCacheSizeEviction(t *testing.T) {
+	document := bytes.Repeat([]byte("x"), 1000)
+	c := NewCache(t.TempDir(), 2500, time.Hour)
+
+	// Entries 1 and 2 fit; entry 3 pushes out the least recently used one
+	for n := byte(1); n <= 2; n++ {
+		if err := c.put(testKey(n), document, nil); err != nil {
+			t.Fatal(err)
+		}
+		ageEntry(t, c, testKey(n), time.Duration(10-n)*time.Minute)
+	}
+	if _, _, ok := c.get(testKey(1)); !ok {
+		t.Fatal("entry 1 missing before the cache is full")
+	}
+	if err := c.put(testKey(3), document, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, ok := c.get(testKey(2)); ok {
+		t.Error("least recently used entry 2 was kept")
+	}
+	for _, n := range []byte{1, 3} {
+		if _, _, ok := c.get(testKey(n)); !ok {
+			t.Errorf("entry %d was evicted", n)
+		}
+	}
+	stats := c.Stats()
+	if stats.Evictions != 1 || stats.SizeBytes > c.maxBytes {
+		t.Errorf("stats = %+v, want 1 eviction and at most %d bytes", stats, c.maxBytes)
+	}
+	c.mu.Lock()
+	tracked := c.size
+	c.mu.Unlock()
+	if tracked != stats.SizeBytes {
+		t.Errorf("tracked size = %d, want %d as on disk", tracked, stats.SizeBytes)
+	}
+
+	// Replacing an entry does not count it twice
+	if err := c.put(testKey(3), document, nil); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.Stats(); stats.Evictions != 1 {
+		t.Errorf("replacing an entry evicted another: %+v", stats)
+	}
+}
+
+func TestCacheFromEnvIsOptIn(t *testing.T) {
+	t.Setenv("PANDOC_CACHE_DIR", t.TempDir())
+	t.Setenv("PANDOC_CACHE", "")
+	if c := CacheFromEnv(); c != nil {
+		t.Error("cache is on without PANDOC_CACHE")
+	}
+	t.Setenv("PANDOC_CACHE", "1")
+	if c := CacheFromEnv(); c == nil {
+		t.Error("cache is off with PANDOC_CACHE=1")
+	}
+}
@@ -0,0 +1,107 @@
+package pandoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultStylesDir is the styles directory used when PANDOC_CSL_DIR is unset
+const defaultStylesDir = "styles"
+
+// styleNamePattern restricts CSL style names so they cannot escape the styles directory
+var styleNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// bibliographyExtensions are the bibliography formats citeproc reads
+var bibliographyExtensions = map[string]bool{
+	".bib": true, ".bibtex": true, ".json": true, ".yaml": true, ".yml": true, ".ris": true,
+}
+
+// StyleRegistry finds CSL citation styles by name in a directory, e.g.
+// "apa" resolves to apa.csl
+type StyleRegistry struct {
+	namedFiles
+}
+
+// NewStyleRegistry creates a registry for the given directory
+func NewStyleRegistry(dir string) *StyleRegistry {
+	return &StyleRegistry{newNamedFiles(dir, styleNamePattern)}
+}
+
+// StyleRegistryFromEnv creates a registry for PANDOC_CSL_DIR, or the styles
+// directory next to the executable by default
+func StyleRegistryFromEnv() *StyleRegistry {
+	return &StyleRegistry{namedFilesFromEnv("PANDOC_CSL_DIR", defaultStylesDir, styleNamePattern)}
+}
+
+// Resolve returns the path of the named CSL style
+func (r *StyleRegistry) Resolve(name string) (string, error) {
+	name = strings.TrimSuffix(name, ".csl")
+	if !r.validName(name) {
+		return "", &OptionError{Option: "csl", Reason: "invalid citation style name: " + name}
+	}
+
+	stylePath := filepath.Join(r.dir, name+".csl")
+	if _, err := os.Stat(stylePath); err != nil {
+		if os.IsNotExist(err) {
+			return "", &OptionError{Option: "csl", Reason: "citation style not found: " + name}
+		}
+		return "", fmt.Errorf("failed to read citation style %s: %v", name, err)
+	}
+	return stylePath, nil
+}
+
+// citationArgs returns the arguments enabling citation processing for the
+// bibliography, inline references and style in opts. Inline references are
+// written to workDir.
+func (p *PandocConverter) citationArgs(opts Options, workDir string) ([]string, error) {
+	if !opts.citations() {
+		return nil, nil
+	}
+
+	args := []string{"--citeproc"}
+
+	if opts.Bibliography != "" {
+		bibliography := normalizePath(opts.Bibliography)
+		if !bibliographyExtensions[strings.ToLower(filepath.Ext(bibliography))] {
+			return nil, &OptionError{Option: "bibliography", Reason: "unsupported bibliography format: " + filepath.Ext(bibliography)}
+		}
+		if _, err := os.Stat(bibliography); err != nil {
+			return nil, &OptionError{Option: "bibliography", Reason: "bibliography file not found: " + bibliography}
+		}
+		args = append(args, "--bibliography="+bibliography)
+	}
+
+	if len(opts.References) > 0 {
+		data, err := json.Marshal(opts.References)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode references: %v", err)
+		}
+		// CSL JSON is recognised by the .json extension
+		refsPath, err := writeWorkFile(workDir, "references-*.json", data)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--bibliography="+refsPath)
+	}
+
+	if opts.CSL != "" {
+		stylePath, err := p.styles.Resolve(opts.CSL)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--csl="+stylePath)
+	}
+
+	if opts.LinkCitations {
+		args = append(args, "--metadata", "link-citations=true")
+	}
+	if opts.LinkBibliography {
+		args = append(args, "--metadata", "link-bibliography=true")
+	}
+
+	return args, nil
+}
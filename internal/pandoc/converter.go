@@ -1,51 +1,96 @@
 package pandoc
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 )
 
+// Converter converts documents between formats. PandocConverter runs the
+// pandoc executable; pandoctest.Fake stands in for it where pandoc is not
+// installed.
+type Converter interface {
+	// ValidateInputFormat checks if the format can be read
+	ValidateInputFormat(format string) bool
+	// ValidateOutputFormat checks if the format can be written
+	ValidateOutputFormat(format string) bool
+	// ConvertString converts text and returns the document in the result
+	ConvertString(ctx context.Context, content, inputFormat, outputFormat string, opts Options) (*Result, error)
+	// ConvertFile converts inputFile, to outputFile if it is not empty
+	ConvertFile(ctx context.Context, inputFile, inputFormat, outputFormat, outputFile string, opts Options) (*Result, error)
+	// ConvertFiles converts inputFiles concatenated in order as one
+	// document, to outputFile if it is not empty
+	ConvertFiles(ctx context.Context, inputFiles []string, inputFormat, outputFormat, outputFile string, opts Options) (*Result, error)
+	// ConvertStringToFile converts text, to outputFile if it is not empty
+	ConvertStringToFile(ctx context.Context, content, inputFormat, outputFormat, outputFile string, opts Options) (*Result, error)
+	// ConvertBytes converts document content, to outputFile if it is not empty
+	ConvertBytes(ctx context.Context, content []byte, inputFormat, outputFormat, outputFile string, opts Options) (*Result, error)
+}
+
+var _ Converter = (*PandocConverter)(nil)
+
 // PandocConverter represents a document converter based on Pandoc
 type PandocConverter struct {
-	pandocPath string
+	timeouts  Timeouts
+	branding  BrandingConfig
+	templates *TemplateRegistry
+	filters   *FilterRegistry
+	styles    *StyleRegistry
+	resources ResourcePolicy
+	scheduler *Scheduler
+	// cache is nil when caching is off
+	cache *Cache
+
+	mu    sync.RWMutex
+	probe *Probe
+	// envPath is the PANDOC_PATH value probe was made for
+	envPath string
 }
 
-// NewConverter creates a new document converter
-func NewConverter() (*PandocConverter, error) {
-	// Try to get path from environment variable
-	pandocPath := os.Getenv("PANDOC_PATH")
-	if pandocPath == "" {
-		// If variable is not set, look for pandoc in system PATH
-		path, err := exec.LookPath("pandoc")
-		if err != nil {
-			return nil, errors.New("Pandoc not found in PATH, please set PANDOC_PATH environment variable")
-		}
-		pandocPath = path
-	}
+// Result is the outcome of a conversion
+type Result struct {
+	// Output holds the converted document when it was not written to a file
+	Output []byte
+	// OutputFile is the file actually written, which differs from the
+	// requested one under the rename policy
+	OutputFile string
+	// Warnings are problems pandoc reported without failing the conversion
+	Warnings []Warning
+	// Cached is set when the document came from the cache without running pandoc
+	Cached bool
+}
 
-	// Check that file exists and is executable
-	info, err := os.Stat(pandocPath)
+// NewConverter creates a new document converter. It finds pandoc and runs
+// pandoc --version once, so a missing or broken executable is reported here
+// rather than on the first conversion.
+func NewConverter() (*PandocConverter, error) {
+	pandocPath, err := findPandoc()
 	if err != nil {
-		return nil, fmt.Errorf("error accessing Pandoc at %s: %v", pandocPath, err)
-	}
-
-	if info.IsDir() {
-		return nil, fmt.Errorf("%s is a directory, not a Pandoc executable", pandocPath)
+		return nil, err
 	}
-
-	// On Windows don't check execution permissions
-	if os.Getenv("OS") != "Windows_NT" && info.Mode()&0111 == 0 {
-		return nil, fmt.Errorf("%s is not executable", pandocPath)
+	probe, err := probePandoc(context.Background(), pandocPath)
+	if err != nil {
+		return nil, err
 	}
 
 	return &PandocConverter{
-		pandocPath: pandocPath,
+		probe:     probe,
+		envPath:   os.Getenv("PANDOC_PATH"),
+		timeouts:  TimeoutsFromEnv(),
+		branding:  BrandingFromEnv(),
+		templates: TemplateRegistryFromEnv(),
+		filters:   FilterRegistryFromEnv(),
+		styles:    StyleRegistryFromEnv(),
+		resources: ResourcePolicyFromEnv(),
+		scheduler: SchedulerFromEnv(),
+		cache:     CacheFromEnv(),
 	}, nil
 }
 
@@ -75,76 +120,59 @@ func NormalizePath(path string) string {
 	return normalizePath(path)
 }
 
-// addCopyright adds SnowWhite AI copyright to the end of the document
-func addCopyright(content string) string {
-	// Use simple markdown syntax instead of HTML
-	copyrightText := `
-
-
---------------------------------------------------------------------------------
+// Filters returns the registry of pandoc filters
+func (p *PandocConverter) Filters() *FilterRegistry {
+	return p.filters
+}
 
-**© 2025 SnowWhite AI - All Rights Reserved**
+// Cache returns the conversion cache, nil when caching is off
+func (p *PandocConverter) Cache() *Cache {
+	return p.cache
+}
 
-`
-	return content + copyrightText
+// Templates returns the registry of named templates
+func (p *PandocConverter) Templates() *TemplateRegistry {
+	return p.templates
 }
 
-// ValidateFormat checks if the format is supported
+// ValidateFormat checks if the format is supported by pandoc as input or output
 func (p *PandocConverter) ValidateFormat(format string) bool {
-	supportedFormats := []string{"markdown", "html", "pdf", "docx", "rst", "latex", "epub", "txt"}
-	for _, f := range supportedFormats {
-		if f == format {
-			return true
-		}
-	}
-	return false
+	return p.ValidateInputFormat(format) || p.ValidateOutputFormat(format)
 }
 
-// ConvertString converts a string from one format to another
-func (p *PandocConverter) ConvertString(content, inputFormat, outputFormat string) (string, error) {
-	// Add copyright to source content
-	if inputFormat == "markdown" {
-		content = addCopyright(content)
-	}
+// ValidateInputFormat checks if the installed pandoc can read the format
+// after resolving aliases such as "md" or "txt"
+func (p *PandocConverter) ValidateInputFormat(format string) bool {
+	reader := ResolveReader(format)
+	return LookupFormat(format).Reader != "" && p.Capabilities().SupportsInput(reader)
+}
+
+// ValidateOutputFormat checks if the installed pandoc can write the format
+// after resolving aliases such as "md" or "txt"
+func (p *PandocConverter) ValidateOutputFormat(format string) bool {
+	writer := ResolveWriter(format)
+	return LookupFormat(format).Writer != "" && p.Capabilities().SupportsOutput(writer)
+}
 
+// ConvertString converts a string from one format to another and returns
+// the converted document in the result
+func (p *PandocConverter) ConvertString(ctx context.Context, content, inputFormat, outputFormat string, opts Options) (*Result, error) {
 	// Format validation
-	if !p.ValidateFormat(inputFormat) || !p.ValidateFormat(outputFormat) {
-		return "", fmt.Errorf("unsupported format: input=%s, output=%s", inputFormat, outputFormat)
+	if !p.ValidateInputFormat(inputFormat) || !p.ValidateOutputFormat(outputFormat) {
+		return nil, &FormatError{Input: inputFormat, Output: outputFormat}
 	}
 
 	// For formats requiring a file output, return error
-	if outputFormat == "pdf" || outputFormat == "docx" || outputFormat == "epub" {
-		return "", fmt.Errorf("output_file is required for %s format", outputFormat)
-	}
-
-	// Create temporary file for input data
-	tmpInput, err := os.CreateTemp("", "pandoc-input-*."+inputFormat)
-	if err != nil {
-		return "", fmt.Errorf("failed to create temporary file: %v", err)
-	}
-	defer os.Remove(tmpInput.Name())
-
-	if _, err := tmpInput.WriteString(content); err != nil {
-		return "", fmt.Errorf("failed to write to temporary file: %v", err)
-	}
-	tmpInput.Close()
-
-	// Run pandoc
-	cmd := exec.Command(p.pandocPath,
-		"-f", inputFormat,
-		"-t", outputFormat,
-		tmpInput.Name())
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("pandoc conversion failed: %v\nOutput: %s", err, string(output))
+	if NeedsOutputFile(outputFormat) {
+		return nil, &ArgumentError{Argument: "output_file", Reason: fmt.Sprintf("required for %s format", outputFormat)}
 	}
 
-	return string(output), nil
+	return p.convert(ctx, []byte(content), nil, inputFormat, outputFormat, "", opts)
 }
 
-// ConvertFile converts a file from one format to another
-func (p *PandocConverter) ConvertFile(inputFile, inputFormat, outputFormat, outputFile string) error {
+// ConvertFile converts a file from one format to another. When outputFile is
+// empty the converted document is returned instead of being written to disk.
+func (p *PandocConverter) ConvertFile(ctx context.Context, inputFile, inputFormat, outputFormat, outputFile string, opts Options) (*Result, error) {
 	// Normalize paths
 	inputFile = normalizePath(inputFile)
 	if outputFile != "" {
@@ -152,229 +180,360 @@ func (p *PandocConverter) ConvertFile(inputFile, inputFormat, outputFormat, outp
 	}
 
 	// Format validation
-	if !p.ValidateFormat(inputFormat) || !p.ValidateFormat(outputFormat) {
-		return fmt.Errorf("unsupported format: input=%s, output=%s", inputFormat, outputFormat)
+	if !p.ValidateInputFormat(inputFormat) || !p.ValidateOutputFormat(outputFormat) {
+		return nil, &FormatError{Input: inputFormat, Output: outputFormat}
 	}
 
 	// Check existence of input file
 	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		return fmt.Errorf("input file not found: %s", inputFile)
+		return nil, &InputNotFoundError{Path: inputFile}
 	}
 
-	// For some formats, output file must be specified
-	needsOutputFile := outputFormat == "pdf" || outputFormat == "docx" ||
-		outputFormat == "epub" || outputFormat == "latex" || outputFormat == "rst"
+	return p.convert(ctx, nil, []string{inputFile}, inputFormat, outputFormat, outputFile, opts)
+}
 
-	if needsOutputFile && outputFile == "" {
-		return fmt.Errorf("output_file is required for %s format", outputFormat)
+// ConvertFiles converts several files, concatenated in order, as one
+// document, e.g. the chapters of a book. When outputFile is empty the
+// converted document is returned instead of being written to disk.
+func (p *PandocConverter) ConvertFiles(ctx context.Context, inputFiles []string, inputFormat, outputFormat, outputFile string, opts Options) (*Result, error) {
+	if len(inputFiles) == 0 {
+		return nil, &ArgumentError{Argument: "input_files", Reason: "at least one input file is required"}
+	}
+	files := make([]string, len(inputFiles))
+	for i, inputFile := range inputFiles {
+		files[i] = normalizePath(inputFile)
+	}
+	if outputFile != "" {
+		outputFile = normalizePath(outputFile)
 	}
 
-	// Determine path to footer file relative to executable
-	execPath, err := os.Executable()
-	if err != nil {
-		execPath = "."
-	}
-	execDir := filepath.Dir(execPath)
-	footerPath := filepath.Join(execDir, "templates", "footer.md")
-
-	// Check if footer.md file exists
-	footerExists := false
-	if _, err := os.Stat(footerPath); err == nil {
-		footerExists = true
-	} else {
-		// Try to find file relative to current directory
-		footerPath = filepath.Join("templates", "footer.md")
-		if _, err := os.Stat(footerPath); err == nil {
-			footerExists = true
-		}
+	// Format validation
+	if !p.ValidateInputFormat(inputFormat) || !p.ValidateOutputFormat(outputFormat) {
+		return nil, &FormatError{Input: inputFormat, Output: outputFormat}
 	}
 
-	// If input format is markdown and footer.md is not applied, add copyright to content
-	if inputFormat == "markdown" && (!footerExists || outputFormat == "txt") {
-		// Read input file content
-		content, err := ioutil.ReadFile(inputFile)
-		if err != nil {
-			return fmt.Errorf("failed to read input file: %v", err)
+	// Check existence of input files
+	for _, inputFile := range files {
+		if _, err := os.Stat(inputFile); os.IsNotExist(err) {
+			return nil, &InputNotFoundError{Path: inputFile}
 		}
+	}
 
-		// Add copyright
-		contentWithCopyright := addCopyright(string(content))
+	return p.convert(ctx, nil, files, inputFormat, outputFormat, outputFile, opts)
+}
 
-		// Create temporary file with updated content
-		tmpInput, err := os.CreateTemp("", "pandoc-input-with-copyright-*."+inputFormat)
-		if err != nil {
-			return fmt.Errorf("failed to create temporary file: %v", err)
-		}
-		defer os.Remove(tmpInput.Name())
+// ConvertStringToFile converts a string to a file. When outputFile is empty
+// the converted document is returned instead of being written to disk.
+func (p *PandocConverter) ConvertStringToFile(ctx context.Context, content, inputFormat, outputFormat, outputFile string, opts Options) (*Result, error) {
+	return p.ConvertBytes(ctx, []byte(content), inputFormat, outputFormat, outputFile, opts)
+}
 
-		if _, err := tmpInput.WriteString(contentWithCopyright); err != nil {
-			return fmt.Errorf("failed to write to temporary file: %v", err)
-		}
-		tmpInput.Close()
+// ConvertBytes converts document content, such as a docx or epub received
+// over the protocol, to a file. When outputFile is empty the converted
+// document is returned instead of being written to disk.
+func (p *PandocConverter) ConvertBytes(ctx context.Context, content []byte, inputFormat, outputFormat, outputFile string, opts Options) (*Result, error) {
+	if outputFile != "" {
+		outputFile = normalizePath(outputFile)
+	}
+
+	// Format validation
+	if !p.ValidateInputFormat(inputFormat) || !p.ValidateOutputFormat(outputFormat) {
+		return nil, &FormatError{Input: inputFormat, Output: outputFormat}
+	}
+
+	return p.convert(ctx, content, nil, inputFormat, outputFormat, outputFile, opts)
+}
 
-		// Use temporary file instead of original
-		inputFile = tmpInput.Name()
+// convert runs one conversion of inputFiles, or of content when there are
+// none. Content is piped to pandoc's stdin and the document is read from
+// stdout unless outputFile is given. Readers and writers that need a real
+// file get one in a private working directory removed when convert returns.
+func (p *PandocConverter) convert(ctx context.Context, content []byte, inputFiles []string, inputFormat, outputFormat, outputFile string, opts Options) (*Result, error) {
+	workDir, cleanup, err := newWorkDir()
+	if err != nil {
+		return nil, err
 	}
+	defer cleanup()
 
-	// If output_file is not specified, use temporary file
-	var tmpOutputFile string
-	if outputFile == "" {
-		tmp, err := os.CreateTemp("", "pandoc-output-*."+outputFormat)
-		if err != nil {
-			return fmt.Errorf("failed to create temporary output file: %v", err)
+	// Request options and branding
+	extraArgs, keyFiles, err := p.requestArgs(opts, outputFormat, workDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// With NoCache pandoc runs anyway and its result replaces the cached one
+	var cacheKey string
+	if p.cache != nil {
+		if cacheKey, err = p.conversionKey(content, inputFiles, inputFormat, outputFormat, extraArgs, keyFiles, workDir); err != nil {
+			return nil, err
 		}
-		tmpOutputFile = tmp.Name()
-		tmp.Close()
-		outputFile = tmpOutputFile
-		defer os.Remove(tmpOutputFile)
-	} else {
-		// Create directory for output file if it doesn't exist
-		dir := filepath.Dir(outputFile)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create output directory: %v", err)
+		if !opts.NoCache {
+			if result, ok, err := p.cached(cacheKey, outputFile, opts.OnExists); ok || err != nil {
+				return result, err
+			}
 		}
 	}
 
-	// Run pandoc
+	// The JSON log records every warning whatever the verbosity, so stderr
+	// does not have to be parsed and --verbose is not needed
+	logFile := filepath.Join(workDir, "pandoc-log.json")
 	args := []string{
-		"-f", inputFormat,
-		"-t", outputFormat,
-		"-o", outputFile,
+		"-f", ResolveReader(inputFormat),
+		"-t", ResolveWriter(outputFormat),
+		"--log=" + logFile,
+	}
+
+	var stdin []byte
+	if len(inputFiles) == 0 {
+		if readsStdin(inputFormat) {
+			stdin = content
+		} else {
+			// ZIP-based readers such as docx need a seekable file
+			inputFile, err := writeWorkFile(workDir, "input-*"+FileExtension(inputFormat), content)
+			if err != nil {
+				return nil, err
+			}
+			inputFiles = []string{inputFile}
+		}
 	}
 
-	// If footer file exists and output format supports inclusions, add it
-	if footerExists && (outputFormat == "docx" || outputFormat == "pdf" || outputFormat == "html") {
-		args = append(args, "--include-after-body", footerPath)
+	var tmpOutputFile, partialFile string
+	switch {
+	case outputFile != "":
+		// Create directory for output file if it doesn't exist
+		dir := filepath.Dir(outputFile)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create output directory: %v", err)
+		}
+		if err := checkOutputFile(outputFile, opts.OnExists); err != nil {
+			return nil, err
+		}
+		// pandoc writes next to the output file, which is only replaced once
+		// the conversion succeeded
+		if partialFile, err = createOutputTemp(outputFile); err != nil {
+			return nil, err
+		}
+		defer os.Remove(partialFile)
+		args = append(args, "-o", partialFile)
+	case !writesStdout(outputFormat):
+		tmpOutputFile = filepath.Join(workDir, "output"+FileExtension(outputFormat))
+		args = append(args, "-o", tmpOutputFile)
+	case IsBinaryFormat(outputFormat):
+		// Binary writers only use stdout when it is requested explicitly
+		args = append(args, "-o", "-")
 	}
 
-	// Add input file at the end
-	args = append(args, inputFile)
+	args = append(args, extraArgs...)
+
+	// Add input files at the end
+	args = append(args, inputFiles...)
 
-	cmd := exec.Command(p.pandocPath, args...)
-	output, err := cmd.CombinedOutput()
+	stdout, stderr, err := p.run(ctx, outputFormat, stdin, args...)
+	warnings := readWarnings(logFile, stderr)
 	if err != nil {
-		return fmt.Errorf("pandoc conversion failed: %v\nOutput: %s", err, string(output))
+		var pandocErr *PandocError
+		if errors.As(err, &pandocErr) {
+			pandocErr.Warnings = warnings
+		}
+		return nil, err
 	}
+	result := &Result{Warnings: warnings}
 
-	// If temporary file was used, read its content
-	if tmpOutputFile != "" {
-		content, err := ioutil.ReadFile(tmpOutputFile)
-		if err != nil {
-			return fmt.Errorf("failed to read output file: %v", err)
+	switch {
+	case partialFile != "":
+		if result.OutputFile, err = commitOutput(partialFile, outputFile, opts.OnExists); err != nil {
+			return nil, err
 		}
-		// For simple formats return content
-		if strings.Contains("markdown html txt", outputFormat) {
-			fmt.Println(string(content))
+	case tmpOutputFile != "":
+		output, err := os.ReadFile(tmpOutputFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read output file: %v", err)
 		}
+		result.Output = output
+	default:
+		result.Output = stdout
 	}
 
-	return nil
+	if cacheKey != "" {
+		p.store(cacheKey, result)
+	}
+	return result, nil
 }
 
-// ConvertStringToFile converts a string to a file
-func (p *PandocConverter) ConvertStringToFile(content, inputFormat, outputFormat, outputFile string) error {
-	// Normalize output file path
-	if outputFile != "" {
-		outputFile = normalizePath(outputFile)
+// conversionKey returns the cache key of a conversion
+func (p *PandocConverter) conversionKey(content []byte, inputFiles []string, inputFormat, outputFormat string, args, files []string, workDir string) (string, error) {
+	probe, err := p.current()
+	if err != nil {
+		return "", err
 	}
-
-	// Format validation
-	if !p.ValidateFormat(inputFormat) || !p.ValidateFormat(outputFormat) {
-		return fmt.Errorf("unsupported format: input=%s, output=%s", inputFormat, outputFormat)
+	key, err := cacheKey(probe.Version, inputFormat, outputFormat, args, files, workDir, content, inputFiles)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute cache key: %v", err)
 	}
+	return key, nil
+}
 
-	// For some formats, output file must be specified
-	needsOutputFile := outputFormat == "pdf" || outputFormat == "docx" ||
-		outputFormat == "epub" || outputFormat == "latex" || outputFormat == "rst"
-
-	if needsOutputFile && outputFile == "" {
-		return fmt.Errorf("output_file is required for %s format", outputFormat)
+// cached returns the cached result of a conversion, written to outputFile if
+// it is not empty. ok is false when the conversion is not cached.
+func (p *PandocConverter) cached(key, outputFile, onExists string) (result *Result, ok bool, err error) {
+	data, entry, ok := p.cache.get(key)
+	if !ok {
+		return nil, false, nil
 	}
-
-	// If input format is markdown, add copyright
-	if inputFormat == "markdown" {
-		content = addCopyright(content)
+	result = &Result{Warnings: entry.Warnings, Cached: true}
+	if outputFile == "" {
+		result.Output = data
+		return result, true, nil
+	}
+	if result.OutputFile, err = WriteOutputFile(data, outputFile, onExists); err != nil {
+		return nil, true, err
 	}
+	return result, true, nil
+}
 
-	// Create temporary file for input data
-	tmpInput, err := os.CreateTemp("", "pandoc-input-*."+inputFormat)
-	if err != nil {
-		return fmt.Errorf("failed to create temporary file: %v", err)
+// store adds a successful conversion to the cache. Failing to cache does not
+// fail the conversion.
+func (p *PandocConverter) store(key string, result *Result) {
+	data := result.Output
+	if result.OutputFile != "" {
+		var err error
+		if data, err = os.ReadFile(result.OutputFile); err != nil {
+			return
+		}
 	}
-	defer os.Remove(tmpInput.Name())
+	p.cache.put(key, data, result.Warnings)
+}
 
-	if _, err := tmpInput.WriteString(content); err != nil {
-		return fmt.Errorf("failed to write to temporary file: %v", err)
+// requestArgs builds the pandoc arguments for the resource policy and the
+// per-request options, template, filters, citations and branding. Temporary
+// files they need are written to workDir. It also returns the files outside
+// workDir the server resolved for the arguments: templates, filters, the
+// citation style, the bibliography and the cover image, whose contents the
+// cache key covers.
+func (p *PandocConverter) requestArgs(opts Options, outputFormat, workDir string) ([]string, []string, error) {
+	args, err := opts.Args()
+	if err != nil {
+		return nil, nil, err
 	}
-	tmpInput.Close()
 
-	// Determine path to footer file relative to executable
-	execPath, err := os.Executable()
+	resourceArgs, err := p.resourceArgs(opts, workDir)
 	if err != nil {
-		execPath = "."
-	}
-	execDir := filepath.Dir(execPath)
-	footerPath := filepath.Join(execDir, "templates", "footer.md")
-
-	// Check if footer.md file exists
-	footerExists := false
-	if _, err := os.Stat(footerPath); err == nil {
-		footerExists = true
-	} else {
-		// Try to find file relative to current directory
-		footerPath = filepath.Join("templates", "footer.md")
-		if _, err := os.Stat(footerPath); err == nil {
-			footerExists = true
-		}
+		return nil, nil, err
 	}
+	args = append(args, resourceArgs...)
 
-	// If output_file is not specified for formats that can be returned as text
-	if outputFile == "" {
-		// Create temporary file for output
-		tmpOutput, err := os.CreateTemp("", "pandoc-output-*."+outputFormat)
+	var files []string
+	if opts.Template != "" {
+		templateArgs, err := p.templates.Resolve(opts.Template, outputFormat)
 		if err != nil {
-			return fmt.Errorf("failed to create temporary output file: %v", err)
-		}
-		outputFile = tmpOutput.Name()
-		tmpOutput.Close()
-		defer os.Remove(outputFile)
-	} else {
-		// Create directory for output file if it doesn't exist
-		dir := filepath.Dir(outputFile)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create output directory: %v", err)
+			return nil, nil, err
 		}
+		args = append(args, templateArgs...)
+		files = append(files, argFiles(templateArgs, "--reference-doc", "--template", "--css")...)
 	}
 
-	// Run pandoc
-	args := []string{
-		"-f", inputFormat,
-		"-t", outputFormat,
-		"-o", outputFile,
+	args = append(args, coverArgs(opts, outputFormat)...)
+	if opts.CoverImage != "" {
+		files = append(files, opts.CoverImage)
 	}
 
-	// If footer file exists and output format supports inclusions, add it
-	if footerExists && (outputFormat == "docx" || outputFormat == "pdf" || outputFormat == "html") {
-		args = append(args, "--include-after-body", footerPath)
+	// User filters run before branding so they cannot alter it
+	filterArgs, err := p.filters.Args(opts.Filters, workDir)
+	if err != nil {
+		return nil, nil, err
 	}
+	args = append(args, filterArgs...)
+	files = append(files, argFiles(filterArgs, "--lua-filter", "--filter")...)
 
-	// Add input file at the end
-	args = append(args, tmpInput.Name())
+	// Citations are processed after user filters, before branding is added
+	citationArgs, err := p.citationArgs(opts, workDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	args = append(args, citationArgs...)
+	files = append(files, argFiles(citationArgs, "--bibliography", "--csl")...)
 
-	cmd := exec.Command(p.pandocPath, args...)
-	output, err := cmd.CombinedOutput()
+	// The rendered branding is passed as metadata, so the arguments cover it
+	brandingArgs, err := p.brandingArgs(opts.Branding, workDir)
 	if err != nil {
-		return fmt.Errorf("pandoc conversion failed: %v\nOutput: %s", err, string(output))
+		return nil, nil, err
 	}
+	args = append(args, brandingArgs...)
 
-	// If output file was not specified and format allows text output
-	if !needsOutputFile && outputFile != "" {
-		content, err := ioutil.ReadFile(outputFile)
-		if err != nil {
-			return fmt.Errorf("failed to read output file: %v", err)
+	return args, files, nil
+}
+
+// argFiles returns the files named by the given flags in args built by the
+// server, written either as --flag=file or as --flag file
+func argFiles(args []string, flags ...string) []string {
+	var files []string
+	for i, arg := range args {
+		for _, flag := range flags {
+			if file, ok := strings.CutPrefix(arg, flag+"="); ok {
+				files = append(files, file)
+			} else if arg == flag && i+1 < len(args) {
+				files = append(files, args[i+1])
+			}
+		}
+	}
+	return files
+}
+
+// run executes pandoc with the given arguments and stdin once the scheduler
+// grants a slot, bounded by the timeout configured for outputFormat and by
+// cancellation of ctx. Time spent waiting for the slot does not count against
+// the timeout. The whole process group is killed when the deadline passes or
+// ctx is cancelled, so LaTeX engines started by pandoc do not outlive the
+// request. It returns pandoc's stdout and stderr separately.
+func (p *PandocConverter) run(ctx context.Context, outputFormat string, stdin []byte, args ...string) ([]byte, []byte, error) {
+	probe, err := p.current()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	release, err := p.scheduler.Acquire(ctx, outputFormat)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("pandoc conversion cancelled: %w", ctx.Err())
+		}
+		return nil, nil, err
+	}
+	defer release()
+
+	timeout := p.timeouts.For(outputFormat)
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, probe.Path, args...)
+	// Paranoid kpathsea mode keeps TeX engines producing PDFs from opening
+	// absolute paths, parent directories and dotfiles
+	cmd.Env = append(os.Environ(), "openin_any=p", "openout_any=p")
+	configureProcessGroup(cmd)
+	// Don't wait forever for grandchildren that keep the output pipes open
+	cmd.WaitDelay = processWaitDelay
+
+	// Without input pandoc reads from the null device, never the server's stdin
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		// Parent context cancelled: the client no longer needs the result
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("pandoc conversion cancelled: %w", ctx.Err())
+		}
+		if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+			return nil, nil, &TimeoutError{Format: outputFormat, Timeout: timeout}
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, nil, pandocRunError(exitErr.ExitCode(), stderr.String())
 		}
-		fmt.Println(string(content))
+		return nil, nil, fmt.Errorf("failed to run pandoc: %v", err)
 	}
 
-	return nil
+	return stdout.Bytes(), stderr.Bytes(), nil
 }
@@ -0,0 +1,280 @@
+package pandoc
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// sniffLimit is how many bytes of a text file are inspected when detecting its format
+const sniffLimit = 64 * 1024
+
+var (
+	zipSignature  = []byte("PK\x03\x04")
+	pdfSignature  = []byte("%PDF-")
+	rtfSignature  = []byte("{\\rtf")
+	epubSignature = []byte("mimetypeapplication/epub+zip")
+
+	htmlPattern     = regexp.MustCompile(`(?i)^\s*(<!doctype\s+html|<html[\s>]|<head[\s>]|<body[\s>])`)
+	xhtmlPattern    = regexp.MustCompile(`(?i)<html[\s>]`)
+	docbookPattern  = regexp.MustCompile(`(?i)<(book|article)[\s>][^<]*docbook|<!doctype\s+(book|article)[^>]*docbook`)
+	latexPattern    = regexp.MustCompile(`(?m)^\s*\\(documentclass|begin\{document\}|usepackage)`)
+	rstDirective    = regexp.MustCompile(`(?m)^\.\. ([a-zA-Z-]+::|_[^:]+:|\|[^|]+\|)`)
+	markdownHeading = regexp.MustCompile(`(?m)^#{1,6}[ \t]+\S`)
+	markdownFence   = regexp.MustCompile("(?m)^ {0,3}```")
+	markdownTildes  = regexp.MustCompile(`(?:\A|\n[ \t]*\n) {0,3}~~~`)
+	// markdownRules are the underline characters that also form setext
+	// headings and horizontal rules in markdown
+	markdownRules     = "=-*_"
+	rstUnderlineChars = "=-~^*+#`:'\"_"
+)
+
+// DetectFormat guesses the format of document content from its signature or
+// characteristic markup. It returns false if no format could be recognized,
+// in which case the content is usually plain markdown.
+func DetectFormat(data []byte) (string, bool) {
+	switch {
+	case bytes.HasPrefix(data, zipSignature):
+		return detectZipFormat(data)
+	case bytes.HasPrefix(data, pdfSignature):
+		return "pdf", true
+	case bytes.HasPrefix(data, rtfSignature):
+		return "rtf", true
+	}
+
+	if len(data) > sniffLimit {
+		data = data[:sniffLimit]
+	}
+	text := string(data)
+	trimmed := strings.TrimSpace(text)
+
+	switch {
+	case htmlPattern.MatchString(text):
+		return "html", true
+	case strings.HasPrefix(trimmed, "<?xml"):
+		if docbookPattern.MatchString(text) {
+			return "docbook", true
+		}
+		if xhtmlPattern.MatchString(text) {
+			return "html", true
+		}
+	case strings.HasPrefix(trimmed, "{") && isNotebook(data):
+		return "ipynb", true
+	case latexPattern.MatchString(text):
+		return "latex", true
+	case looksLikeRST(text):
+		return "rst", true
+	}
+
+	return "", false
+}
+
+// DetectFileFormat guesses the format of a file from its contents
+func DetectFileFormat(path string) (string, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	header := make([]byte, len(zipSignature))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return "", false
+	}
+
+	// ZIP-based formats need the central directory at the end of the file
+	if bytes.Equal(header, zipSignature) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false
+		}
+		return detectZipFormat(data)
+	}
+
+	data := make([]byte, sniffLimit)
+	copy(data, header)
+	n, _ := io.ReadFull(f, data[len(header):])
+	return DetectFormat(data[:len(header)+n])
+}
+
+// detectZipFormat distinguishes EPUB, OOXML and OpenDocument archives
+func detectZipFormat(data []byte) (string, bool) {
+	// EPUB requires an uncompressed "mimetype" entry as the first file
+	if len(data) > 30 && bytes.HasPrefix(data[30:], epubSignature) {
+		return "epub", true
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", false
+	}
+
+	for _, file := range archive.File {
+		switch {
+		case file.Name == "word/document.xml":
+			return "docx", true
+		case file.Name == "ppt/presentation.xml":
+			return "pptx", true
+		case file.Name == "mimetype":
+			if mimetype := readZipEntry(file); strings.HasPrefix(mimetype, "application/vnd.oasis.opendocument.text") {
+				return "odt", true
+			} else if mimetype == "application/epub+zip" {
+				return "epub", true
+			}
+		case file.Name == "META-INF/container.xml":
+			return "epub", true
+		}
+	}
+
+	return "", false
+}
+
+// readZipEntry reads a small archive entry as a trimmed string
+func readZipEntry(file *zip.File) string {
+	r, err := file.Open()
+	if err != nil {
+		return ""
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, 256))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// isNotebook checks if data is a Jupyter notebook
+func isNotebook(data []byte) bool {
+	var notebook struct {
+		Cells    []json.RawMessage `json:"cells"`
+		Nbformat *int              `json:"nbformat"`
+	}
+	if err := json.Unmarshal(data, &notebook); err != nil {
+		return false
+	}
+	return notebook.Nbformat != nil && notebook.Cells != nil
+}
+
+// looksLikeRST checks for reStructuredText directives or section underlines.
+// Content with ATX headings or code fences is markdown whatever its other
+// lines look like; a run of tildes is only a fence after a blank line, as
+// RST underlines follow their title. Underlines of markdownRules are valid
+// markdown too, so those only count when the title also has an overline.
+// Other underlines count when a blank line and more text follow them.
+func looksLikeRST(text string) bool {
+	if rstDirective.MatchString(text) {
+		return true
+	}
+	if markdownHeading.MatchString(text) || markdownFence.MatchString(text) || markdownTildes.MatchString(text) {
+		return false
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 1; i < len(lines); i++ {
+		title := strings.TrimRight(lines[i-1], " \t")
+		underline := strings.TrimRight(lines[i], " \t")
+		if strings.TrimSpace(title) == "" || !isAdornment(underline) || len(underline) < len(title) {
+			continue
+		}
+		if isAdornment(title) {
+			continue
+		}
+
+		if i >= 2 && strings.TrimRight(lines[i-2], " \t") == underline {
+			return true
+		}
+		if !strings.ContainsRune(markdownRules, rune(underline[0])) && startsSection(lines[i+1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// startsSection checks if lines, which follow an underline, are a blank line
+// and then the section text
+func startsSection(lines []string) bool {
+	if len(lines) < 2 || strings.TrimSpace(lines[0]) != "" {
+		return false
+	}
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isAdornment checks if line is a run of one repeated RST punctuation character
+func isAdornment(line string) bool {
+	if len(line) < 3 || !strings.ContainsRune(rstUnderlineChars, rune(line[0])) {
+		return false
+	}
+	return strings.Count(line, line[:1]) == len(line)
+}
+
+// Sources of a format reported back to the client
+const (
+	FormatSourceArgument  = "argument"
+	FormatSourceExtension = "file_extension"
+	FormatSourceContent   = "content"
+	FormatSourceMIMEType  = "mime_type"
+	FormatSourceDefault   = "default"
+)
+
+// DefaultFormat is used when a format is neither given nor detected
+const DefaultFormat = "markdown"
+
+// InferInputFormat determines the input format from the string contents or,
+// when no contents are given, from the input file extension and then the file
+// contents. It returns the format and its source.
+func InferInputFormat(inputFile, contents string) (string, string) {
+	if contents != "" {
+		if format, ok := DetectFormat([]byte(contents)); ok {
+			return format, FormatSourceContent
+		}
+	} else if inputFile != "" {
+		if format, ok := FormatForFile(inputFile); ok {
+			return format, FormatSourceExtension
+		}
+		if format, ok := DetectFileFormat(inputFile); ok {
+			return format, FormatSourceContent
+		}
+	}
+	return DefaultFormat, FormatSourceDefault
+}
+
+// InferContentFormat determines the format of binary input content from its
+// signature, then from the name and media type it was sent with. It returns
+// the format and its source.
+func InferContentFormat(data []byte, name, mimeType string) (string, string) {
+	if format, ok := DetectFormat(data); ok {
+		return format, FormatSourceContent
+	}
+	if name != "" {
+		if format, ok := FormatForFile(name); ok {
+			return format, FormatSourceExtension
+		}
+	}
+	if mimeType != "" {
+		if format, ok := FormatForMIMEType(mimeType); ok {
+			return format, FormatSourceMIMEType
+		}
+	}
+	return DefaultFormat, FormatSourceDefault
+}
+
+// InferOutputFormat determines the output format from the output file
+// extension. It returns the format and its source.
+func InferOutputFormat(outputFile string) (string, string) {
+	if outputFile != "" {
+		if format, ok := FormatForFile(outputFile); ok {
+			return format, FormatSourceExtension
+		}
+	}
+	return DefaultFormat, FormatSourceDefault
+}
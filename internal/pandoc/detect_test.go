@@ -0,0 +1,40 @@
+package pandoc
+
+import "testing"
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "plain markdown", content: "Some *text* here.\n", want: ""},
+		{name: "code fence closing under a brace", content: "# T\n\n```go\nfunc f() {\n}\n```\n", want: ""},
+		{name: "code fence without a heading", content: "text\n\n```\nx\n```\n\nmore\n", want: ""},
+		{name: "tilde code fence", content: "a\n\n~~~\ncode\n~~~\n\nmore\n", want: ""},
+		{name: "horizontal rule after emphasis", content: "*a*\n***\n", want: ""},
+		{name: "horizontal rule between paragraphs", content: "one\n___\n\ntwo\n", want: ""},
+		{name: "RST title with star overline", content: "*****\nTitle\n*****\n\ntext\n", want: "rst"},
+		{name: "setext heading with equals", content: "Title\n=====\n\ntext\n", want: ""},
+		{name: "setext heading with dashes", content: "Title\n-----\n\ntext\n", want: ""},
+		{name: "ATX heading over an RST-like underline", content: "# Doc\n\nTitle\n~~~~~\n\ntext\n", want: ""},
+		{name: "underline shorter than the title", content: "Long title\n~~~\n\ntext\n", want: ""},
+		{name: "RST title with overline", content: "=====\nTitle\n=====\n\ntext\n", want: "rst"},
+		{name: "RST section with tilde underline", content: "Intro\n\nSection\n~~~~~~~\n\ntext\n", want: "rst"},
+		{name: "RST section with caret underline", content: "Section\n^^^^^^^\n\ntext\n", want: "rst"},
+		{name: "RST directive", content: "Text\n\n.. note:: Careful\n", want: "rst"},
+		{name: "RST substitution", content: ".. |logo| image:: logo.png\n", want: "rst"},
+		{name: "html", content: "<!DOCTYPE html>\n<html><body></body></html>\n", want: "html"},
+		{name: "latex", content: "\\documentclass{article}\n\\begin{document}\nx\n\\end{document}\n", want: "latex"},
+		{name: "pdf", content: "%PDF-1.7\n", want: "pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := DetectFormat([]byte(tt.content))
+			if ok != (tt.want != "") || got != tt.want {
+				t.Errorf("DetectFormat(%q) = %q, %v, want %q", tt.content, got, ok, tt.want)
+			}
+		})
+	}
+}
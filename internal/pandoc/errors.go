@@ -0,0 +1,215 @@
+package pandoc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Error kinds reported to clients in machine-readable error results
+const (
+	ErrorInvalidArgument = "invalid_argument"
+	ErrorInvalidFormat   = "invalid_format"
+	ErrorInvalidOption   = "invalid_option"
+	ErrorInputNotFound   = "input_not_found"
+	ErrorPathDenied      = "path_denied"
+	ErrorOutputExists    = "output_exists"
+	ErrorPandocNotFound  = "pandoc_not_found"
+	ErrorPandocFailed    = "pandoc_failed"
+	ErrorMissingLatex    = "missing_latex"
+	ErrorTimeout         = "timeout"
+	ErrorServerBusy      = "server_busy"
+	ErrorCancelled       = "cancelled"
+	ErrorInternal        = "internal"
+)
+
+// maxErrorStderr bounds the pandoc stderr kept in an error, in bytes
+const maxErrorStderr = 4 << 10
+
+// pandocExitPDFProgramNotFound is pandoc's exit code when the PDF engine is missing
+const pandocExitPDFProgramNotFound = 47
+
+// missingEnginePattern matches pandoc's message for a missing PDF engine
+var missingEnginePattern = regexp.MustCompile(`(\S+) not found\. Please select a different --pdf-engine`)
+
+// pandocExitHints explain the pandoc exit codes a client can do something about
+var pandocExitHints = map[int]string{
+	5:  "The template is invalid; check the template argument or the template file.",
+	6:  "An option was rejected by pandoc; check the conversion options.",
+	21: "The input format is not supported by this pandoc; call list_formats for the supported ones.",
+	22: "The output format is not supported by this pandoc; call list_formats for the supported ones.",
+	23: "A format extension is not supported; remove it from the format name.",
+	43: "The PDF engine failed; the LaTeX log in stderr shows why, often a missing package or an unsupported character.",
+	61: "A remote resource could not be fetched; check the URL or embed the resource.",
+	64: "The input could not be parsed; check that input_format matches the content.",
+	83: "A filter failed; check the filters argument.",
+	84: "A Lua filter failed; check the filters argument.",
+	92: "The input is not valid UTF-8; convert it to UTF-8 first.",
+	99: "A resource such as an image was not found; check the paths referenced by the document.",
+}
+
+// KindError is an error that knows its kind and how the client may fix it
+type KindError interface {
+	error
+	// Kind returns one of the Error* kinds
+	Kind() string
+	// Hint returns a suggestion for the client, or an empty string
+	Hint() string
+}
+
+// ErrorKind returns the kind of err, ErrorInternal for errors without one
+func ErrorKind(err error) string {
+	var kindErr KindError
+	if errors.As(err, &kindErr) {
+		return kindErr.Kind()
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrorCancelled
+	}
+	return ErrorInternal
+}
+
+// ErrorHint returns the suggestion for err, if any
+func ErrorHint(err error) string {
+	var kindErr KindError
+	if errors.As(err, &kindErr) {
+		return kindErr.Hint()
+	}
+	if errors.Is(err, context.Canceled) {
+		return "The request was cancelled by the client."
+	}
+	return ""
+}
+
+// ArgumentError reports an invalid or missing tool argument
+type ArgumentError struct {
+	Argument string `json:"argument"`
+	Reason   string `json:"reason"`
+}
+
+func (e *ArgumentError) Error() string {
+	return fmt.Sprintf("invalid argument %s: %s", e.Argument, e.Reason)
+}
+
+func (e *ArgumentError) Kind() string { return ErrorInvalidArgument }
+
+func (e *ArgumentError) Hint() string {
+	return fmt.Sprintf("Fix the %s argument and call the tool again.", e.Argument)
+}
+
+// FormatError reports a format pandoc cannot read or write
+type FormatError struct {
+	Input  string `json:"input_format,omitempty"`
+	Output string `json:"output_format,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func (e *FormatError) Error() string {
+	msg := fmt.Sprintf("unsupported format: input=%s, output=%s", e.Input, e.Output)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+func (e *FormatError) Kind() string { return ErrorInvalidFormat }
+
+func (e *FormatError) Hint() string {
+	return "Call list_formats for the formats the installed pandoc supports, or omit the format to infer it."
+}
+
+// InputNotFoundError reports a missing input file
+type InputNotFoundError struct {
+	Path string `json:"path"`
+}
+
+func (e *InputNotFoundError) Error() string {
+	return fmt.Sprintf("input file not found: %s", e.Path)
+}
+
+func (e *InputNotFoundError) Kind() string { return ErrorInputNotFound }
+
+func (e *InputNotFoundError) Hint() string {
+	return "Check the input_file path; relative paths are resolved against the server's working directory."
+}
+
+// PandocNotFoundError reports that no usable pandoc executable was found
+type PandocNotFoundError struct {
+	Path   string `json:"path,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (e *PandocNotFoundError) Error() string {
+	if e.Path == "" {
+		return e.Reason
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Reason)
+}
+
+func (e *PandocNotFoundError) Kind() string { return ErrorPandocNotFound }
+
+func (e *PandocNotFoundError) Hint() string {
+	return "Install pandoc on the server or point PANDOC_PATH at the pandoc executable."
+}
+
+// PandocError reports a pandoc run that exited with an error
+type PandocError struct {
+	ExitCode int `json:"exit_code"`
+	// Stderr is the end of pandoc's error output
+	Stderr string `json:"stderr"`
+	// Warnings were reported before pandoc failed and may explain the failure
+	Warnings []Warning `json:"warnings,omitempty"`
+}
+
+func (e *PandocError) Error() string {
+	return fmt.Sprintf("pandoc conversion failed (exit code %d): %s", e.ExitCode, e.Stderr)
+}
+
+func (e *PandocError) Kind() string { return ErrorPandocFailed }
+
+func (e *PandocError) Hint() string {
+	if hint, ok := pandocExitHints[e.ExitCode]; ok {
+		return hint
+	}
+	return "See stderr for pandoc's explanation."
+}
+
+// MissingLatexError reports that the PDF engine pandoc needs is not installed
+type MissingLatexError struct {
+	Engine string `json:"engine,omitempty"`
+	Stderr string `json:"stderr"`
+}
+
+func (e *MissingLatexError) Error() string {
+	if e.Engine == "" {
+		return "pdf engine not found"
+	}
+	return fmt.Sprintf("pdf engine not found: %s", e.Engine)
+}
+
+func (e *MissingLatexError) Kind() string { return ErrorMissingLatex }
+
+func (e *MissingLatexError) Hint() string {
+	return "Install a LaTeX distribution such as TeX Live or MiKTeX on the server, or convert to html or docx instead."
+}
+
+// pandocRunError classifies a failed pandoc run from its exit code and stderr
+func pandocRunError(exitCode int, stderr string) error {
+	stderr = stderrTail(stderr)
+	if m := missingEnginePattern.FindStringSubmatch(stderr); m != nil {
+		return &MissingLatexError{Engine: m[1], Stderr: stderr}
+	}
+	if exitCode == pandocExitPDFProgramNotFound {
+		return &MissingLatexError{Stderr: stderr}
+	}
+	return &PandocError{ExitCode: exitCode, Stderr: stderr}
+}
+
+// stderrTail keeps the end of stderr, where pandoc and LaTeX report the error
+func stderrTail(stderr string) string {
+	if len(stderr) <= maxErrorStderr {
+		return stderr
+	}
+	return "..." + stderr[len(stderr)-maxErrorStderr:]
+}
@@ -0,0 +1,140 @@
+package pandoc
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// builtinFilters are Lua filters shipped with the server
+//
+//go:embed lua/filters/*.lua
+var builtinFilters embed.FS
+
+// Kinds of pandoc filters
+const (
+	FilterKindLua  = "lua"
+	FilterKindJSON = "json"
+)
+
+// defaultFiltersDir is the registry directory used when PANDOC_FILTERS_DIR is unset
+const defaultFiltersDir = "filters"
+
+// jsonFilterExtensions are scripts pandoc runs through an interpreter as JSON filters
+var jsonFilterExtensions = map[string]bool{
+	".py": true, ".js": true, ".rb": true, ".pl": true, ".php": true, ".r": true,
+}
+
+// Filter is a registered pandoc filter
+type Filter struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Path    string `json:"file,omitempty"`
+	Builtin bool   `json:"builtin"`
+}
+
+// FilterRegistry finds filters in a directory and among the built-in filters.
+// A filter in the directory overrides a built-in filter with the same name.
+type FilterRegistry struct {
+	namedFiles
+}
+
+// NewFilterRegistry creates a registry for the given directory
+func NewFilterRegistry(dir string) *FilterRegistry {
+	return &FilterRegistry{newNamedFiles(dir, registryNamePattern)}
+}
+
+// FilterRegistryFromEnv creates a registry for PANDOC_FILTERS_DIR, or the
+// filters directory next to the executable by default
+func FilterRegistryFromEnv() *FilterRegistry {
+	return &FilterRegistry{namedFilesFromEnv("PANDOC_FILTERS_DIR", defaultFiltersDir, registryNamePattern)}
+}
+
+// List returns the built-in and directory filters sorted by name
+func (r *FilterRegistry) List() ([]Filter, error) {
+	byName := make(map[string]Filter)
+
+	builtins, _ := fs.ReadDir(builtinFilters, "lua/filters")
+	for _, entry := range builtins {
+		name := strings.TrimSuffix(entry.Name(), ".lua")
+		byName[name] = Filter{Name: name, Kind: FilterKindLua, Builtin: true}
+	}
+
+	files, err := r.list()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		kind := ""
+		switch {
+		case strings.EqualFold(file.Ext, ".lua"):
+			kind = FilterKindLua
+		case jsonFilterExtensions[strings.ToLower(file.Ext)]:
+			kind = FilterKindJSON
+		case file.Ext == "":
+			// Extensionless executables are JSON filters
+			if info, err := file.Entry.Info(); err == nil && info.Mode()&0111 != 0 {
+				kind = FilterKindJSON
+			}
+		}
+		if kind == "" {
+			continue
+		}
+
+		byName[file.Name] = Filter{Name: file.Name, Kind: kind, Path: file.Path}
+	}
+
+	filters := make([]Filter, 0, len(byName))
+	for _, f := range byName {
+		filters = append(filters, f)
+	}
+	sort.Slice(filters, func(i, j int) bool { return filters[i].Name < filters[j].Name })
+	return filters, nil
+}
+
+// Args returns the --lua-filter/--filter arguments running the named filters
+// in the given order. Built-in filters are copied to workDir for pandoc to read.
+func (r *FilterRegistry) Args(names []string, workDir string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	filters, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	registered := make(map[string]Filter, len(filters))
+	for _, f := range filters {
+		registered[f.Name] = f
+	}
+
+	var args []string
+	for _, name := range names {
+		f, ok := registered[name]
+		if !ok {
+			return nil, &OptionError{Option: "filters", Reason: "filter not registered: " + name}
+		}
+
+		filterPath := f.Path
+		if f.Builtin {
+			data, err := builtinFilters.ReadFile(path.Join("lua/filters", name+".lua"))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read built-in filter %s: %v", name, err)
+			}
+			if filterPath, err = writeWorkFile(workDir, "filter-"+name+"-*.lua", data); err != nil {
+				return nil, err
+			}
+		}
+
+		if f.Kind == FilterKindLua {
+			args = append(args, "--lua-filter", filterPath)
+		} else {
+			args = append(args, "--filter", filterPath)
+		}
+	}
+
+	return args, nil
+}
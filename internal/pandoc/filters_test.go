@@ -0,0 +1,252 @@
+package pandoc
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// astDumpFilter writes the document, as the filters before it left it, as
+// pandoc JSON to the file named by the PANDOC_AST_DUMP environment variable
+const astDumpFilter = `
+function Pandoc(doc)
+  local f = assert(io.open(os.getenv('PANDOC_AST_DUMP'), 'w'))
+  f:write(pandoc.write(doc, 'json'))
+  f:close()
+end
+`
+
+// requirePandoc skips the test when pandoc is not installed
+func requirePandoc(t *testing.T) string {
+	t.Helper()
+	path, err := exec.LookPath("pandoc")
+	if err != nil {
+		t.Skip("pandoc is not installed")
+	}
+	return path
+}
+
+// filterAST converts markdown input to format with args, which run the
+// filters under test, and returns the document those filters produced
+func filterAST(t *testing.T, input, format string, args ...string) map[string]any {
+	t.Helper()
+	pandocPath := requirePandoc(t)
+	dir := t.TempDir()
+
+	dumpFilter := filepath.Join(dir, "dump.lua")
+	if err := os.WriteFile(dumpFilter, []byte(astDumpFilter), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	astFile := filepath.Join(dir, "ast.json")
+
+	cmdArgs := append([]string{"-f", "markdown", "-t", format, "-o", filepath.Join(dir, "out")}, args...)
+	cmdArgs = append(cmdArgs, "--lua-filter", dumpFilter)
+	cmd := exec.Command(pandocPath, cmdArgs...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(os.Environ(), "PANDOC_AST_DUMP="+astFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("pandoc %v failed: %v\n%s", cmdArgs, err, output)
+	}
+
+	data, err := os.ReadFile(astFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// builtinFilterArgs returns the arguments running the named built-in filters
+func builtinFilterArgs(t *testing.T, names ...string) []string {
+	t.Helper()
+	args, err := NewFilterRegistry(t.TempDir()).Args(names, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return args
+}
+
+// collect returns the AST elements with the given tag, in document order
+func collect(node any, tag string) []map[string]any {
+	var found []map[string]any
+	switch n := node.(type) {
+	case map[string]any:
+		if n["t"] == tag {
+			found = append(found, n)
+		}
+		for _, key := range []string{"c", "blocks"} {
+			found = append(found, collect(n[key], tag)...)
+		}
+	case []any:
+		for _, item := range n {
+			found = append(found, collect(item, tag)...)
+		}
+	}
+	return found
+}
+
+// blockTags returns the tags of the top-level blocks
+func blockTags(doc map[string]any) []string {
+	var tags []string
+	for _, block := range doc["blocks"].([]any) {
+		tags = append(tags, block.(map[string]any)["t"].(string))
+	}
+	return tags
+}
+
+// headerIDs returns the identifiers of the headers
+func headerIDs(doc map[string]any) []string {
+	var ids []string
+	for _, header := range collect(doc, "Header") {
+		attr := header["c"].([]any)[1].([]any)
+		ids = append(ids, attr[0].(string))
+	}
+	return ids
+}
+
+// linkTargets returns the targets of the links
+func linkTargets(doc map[string]any) []string {
+	var targets []string
+	for _, link := range collect(doc, "Link") {
+		target := link["c"].([]any)[2].([]any)
+		targets = append(targets, target[0].(string))
+	}
+	return targets
+}
+
+// rawFormats returns the formats of the raw blocks
+func rawFormats(doc map[string]any) []string {
+	var formats []string
+	for _, raw := range collect(doc, "RawBlock") {
+		formats = append(formats, raw["c"].([]any)[0].(string))
+	}
+	return formats
+}
+
+func TestBuiltinFilters(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		input  string
+		format string
+		args   []string
+		check  func(t *testing.T, doc map[string]any)
+	}{
+		{
+			name:   "remove-comments drops HTML comments",
+			filter: "remove-comments",
+			input:  "keep\n\n<!-- secret block -->\n\ntext <!-- secret inline --> more\n",
+			format: "html",
+			check: func(t *testing.T, doc map[string]any) {
+				if raw := len(collect(doc, "RawBlock")) + len(collect(doc, "RawInline")); raw != 0 {
+					t.Errorf("%d raw elements left, want none", raw)
+				}
+				if got := blockTags(doc); !reflect.DeepEqual(got, []string{"Para", "Para"}) {
+					t.Errorf("blocks = %v, want two paragraphs", got)
+				}
+			},
+		},
+		{
+			name:   "remove-comments drops comment divs and internal spans",
+			filter: "remove-comments",
+			input:  "::: comment\nhidden\n:::\n\nshown [note]{.internal}\n",
+			format: "html",
+			check: func(t *testing.T, doc map[string]any) {
+				if n := len(collect(doc, "Div")) + len(collect(doc, "Span")); n != 0 {
+					t.Errorf("%d divs or spans left, want none", n)
+				}
+				if got := blockTags(doc); !reflect.DeepEqual(got, []string{"Para"}) {
+					t.Errorf("blocks = %v, want the shown paragraph", got)
+				}
+			},
+		},
+		{
+			name:   "heading-anchors slugifies and deduplicates identifiers",
+			filter: "heading-anchors",
+			input:  "# Getting_Started\n\n# Getting_Started\n\n[go](#getting_started)\n",
+			format: "html",
+			check: func(t *testing.T, doc map[string]any) {
+				if got, want := headerIDs(doc), []string{"getting-started", "getting-started-1"}; !reflect.DeepEqual(got, want) {
+					t.Errorf("header ids = %v, want %v", got, want)
+				}
+				if got, want := linkTargets(doc), []string{"#getting-started"}; !reflect.DeepEqual(got, want) {
+					t.Errorf("link targets = %v, want %v", got, want)
+				}
+			},
+		},
+		{
+			name:   "relative-link-rewrite points source links at converted files",
+			filter: "relative-link-rewrite",
+			input:  "[a](other.md#x) [b](https://example.com/x.md) [c](#local) [d](image.png) [e](../up/guide.rst)\n",
+			format: "html",
+			check: func(t *testing.T, doc map[string]any) {
+				want := []string{"other.html#x", "https://example.com/x.md", "#local", "image.png", "../up/guide.html"}
+				if got := linkTargets(doc); !reflect.DeepEqual(got, want) {
+					t.Errorf("link targets = %v, want %v", got, want)
+				}
+			},
+		},
+		{
+			name:   "relative-link-rewrite honours the extension and source metadata",
+			filter: "relative-link-rewrite",
+			input:  "[a](other.md) [b](guide.rst)\n",
+			format: "docx",
+			args:   []string{"--metadata", "relative-link-sources=rst", "--metadata", "relative-link-extension=.htm"},
+			check: func(t *testing.T, doc map[string]any) {
+				want := []string{"other.md", "guide.htm"}
+				if got := linkTargets(doc); !reflect.DeepEqual(got, want) {
+					t.Errorf("link targets = %v, want %v", got, want)
+				}
+			},
+		},
+		{
+			name:   "chapter-breaks starts later chapters on a new page in HTML",
+			filter: ChapterBreaksFilter,
+			input:  "# One\n\ntext\n\n# Two\n\n## Section\n\n# Three\n",
+			format: "html",
+			check: func(t *testing.T, doc map[string]any) {
+				want := []string{"Header", "Para", "RawBlock", "Header", "Header", "RawBlock", "Header"}
+				if got := blockTags(doc); !reflect.DeepEqual(got, want) {
+					t.Errorf("blocks = %v, want %v", got, want)
+				}
+			},
+		},
+		{
+			name:   "chapter-breaks uses Word page breaks in docx",
+			filter: ChapterBreaksFilter,
+			input:  "# One\n\n# Two\n",
+			format: "docx",
+			check: func(t *testing.T, doc map[string]any) {
+				if got, want := rawFormats(doc), []string{"openxml"}; !reflect.DeepEqual(got, want) {
+					t.Errorf("raw block formats = %v, want %v", got, want)
+				}
+			},
+		},
+		{
+			name:   "chapter-breaks leaves LaTeX chapters alone",
+			filter: ChapterBreaksFilter,
+			input:  "# One\n\n# Two\n",
+			format: "latex",
+			check: func(t *testing.T, doc map[string]any) {
+				if got, want := blockTags(doc), []string{"Header", "Header"}; !reflect.DeepEqual(got, want) {
+					t.Errorf("blocks = %v, want %v", got, want)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(builtinFilterArgs(t, tt.filter), tt.args...)
+			tt.check(t, filterAST(t, tt.input, tt.format, args...))
+		})
+	}
+}
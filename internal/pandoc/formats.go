@@ -0,0 +1,229 @@
+package pandoc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// discoveryTimeout bounds each of the pandoc --list-* queries
+const discoveryTimeout = 15 * time.Second
+
+// discoveryRetryInterval is how long a failed discovery is remembered before
+// pandoc is queried again
+const discoveryRetryInterval = time.Minute
+
+// Fallback format lists used when the pandoc binary cannot be queried
+var (
+	fallbackInputFormats  = []string{"docx", "epub", "html", "latex", "markdown", "rst"}
+	fallbackOutputFormats = []string{"docx", "epub", "html", "latex", "markdown", "pdf", "plain", "rst"}
+)
+
+// Capabilities describes the readers, writers and extensions of a pandoc binary
+type Capabilities struct {
+	InputFormats  []string
+	OutputFormats []string
+	Extensions    []string
+
+	inputSet     map[string]bool
+	outputSet    map[string]bool
+	extensionSet map[string]bool
+}
+
+// capabilitiesEntry is the outcome of querying one pandoc executable. A
+// failed query holds the fallback capabilities and its error until retryAt.
+type capabilitiesEntry struct {
+	capabilities *Capabilities
+	err          error
+	retryAt      time.Time
+}
+
+// capabilitiesCache holds discovered capabilities per pandoc executable path
+var (
+	capabilitiesMu    sync.Mutex
+	capabilitiesCache = make(map[string]capabilitiesEntry)
+)
+
+// newCapabilities builds capabilities with lookup sets from the given lists
+func newCapabilities(inputs, outputs, extensions []string) *Capabilities {
+	c := &Capabilities{
+		InputFormats:  inputs,
+		OutputFormats: outputs,
+		Extensions:    extensions,
+		inputSet:      toSet(inputs),
+		outputSet:     toSet(outputs),
+		extensionSet:  toSet(extensions),
+	}
+	return c
+}
+
+// FallbackCapabilities returns the built-in format list used when pandoc is unavailable
+func FallbackCapabilities() *Capabilities {
+	return newCapabilities(fallbackInputFormats, fallbackOutputFormats, nil)
+}
+
+// DiscoverCapabilities queries the pandoc binary for its supported formats and
+// extensions. The result is cached per executable path, so only the first
+// call runs pandoc. On failure the fallback capabilities are returned with
+// the error, and both are cached until discoveryRetryInterval has passed.
+func (p *PandocConverter) DiscoverCapabilities(ctx context.Context) (*Capabilities, error) {
+	probe, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+	return discoverCapabilities(ctx, probe.Path)
+}
+
+// discoverCapabilities queries the executable at path, caching the result.
+// The lock is not held while pandoc runs, so a slow binary does not block
+// lookups for other paths.
+func discoverCapabilities(ctx context.Context, path string) (*Capabilities, error) {
+	capabilitiesMu.Lock()
+	entry, ok := capabilitiesCache[path]
+	capabilitiesMu.Unlock()
+	if ok && (entry.err == nil || time.Now().Before(entry.retryAt)) {
+		return entry.capabilities, entry.err
+	}
+
+	c, err := queryCapabilities(ctx, path)
+	if err != nil {
+		entry = capabilitiesEntry{
+			capabilities: FallbackCapabilities(),
+			err:          err,
+			retryAt:      time.Now().Add(discoveryRetryInterval),
+		}
+	} else {
+		entry = capabilitiesEntry{capabilities: c}
+	}
+
+	capabilitiesMu.Lock()
+	capabilitiesCache[path] = entry
+	capabilitiesMu.Unlock()
+	return entry.capabilities, entry.err
+}
+
+// queryCapabilities runs the pandoc --list-* queries for the executable at path
+func queryCapabilities(ctx context.Context, path string) (*Capabilities, error) {
+	inputs, err := listQuery(ctx, path, "--list-input-formats")
+	if err != nil {
+		return nil, err
+	}
+	outputs, err := listQuery(ctx, path, "--list-output-formats")
+	if err != nil {
+		return nil, err
+	}
+	extensions, err := listQuery(ctx, path, "--list-extensions")
+	if err != nil {
+		return nil, err
+	}
+
+	// Extensions are listed with their default state, e.g. "+smart" or "-emoji"
+	for i, ext := range extensions {
+		extensions[i] = strings.TrimLeft(ext, "+-")
+	}
+	return newCapabilities(inputs, outputs, extensions), nil
+}
+
+// Capabilities returns the discovered capabilities, falling back to the
+// built-in list if pandoc cannot be queried
+func (p *PandocConverter) Capabilities() *Capabilities {
+	c, _ := p.DiscoverCapabilities(context.Background())
+	if c == nil {
+		return FallbackCapabilities()
+	}
+	return c
+}
+
+// listQuery runs pandoc with a --list-* flag and returns the listed names sorted
+func listQuery(ctx context.Context, path, flag string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path, flag)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("pandoc %s failed: %v\nOutput: %s", flag, err, stderr.String())
+	}
+
+	var names []string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// SupportsInput checks if format (optionally with +ext/-ext modifiers) can be read
+func (c *Capabilities) SupportsInput(format string) bool {
+	return c.supports(c.inputSet, format)
+}
+
+// SupportsOutput checks if format (optionally with +ext/-ext modifiers) can be written
+func (c *Capabilities) SupportsOutput(format string) bool {
+	return c.supports(c.outputSet, format)
+}
+
+// supports checks the base format against formats and every extension
+// modifier against the known extensions
+func (c *Capabilities) supports(formats map[string]bool, format string) bool {
+	base, extensions := SplitFormat(format)
+	if !formats[base] {
+		return false
+	}
+	// Without a discovered extension list accept any modifier and let pandoc decide
+	if len(c.extensionSet) == 0 {
+		return true
+	}
+	for _, ext := range extensions {
+		if !c.extensionSet[ext] {
+			return false
+		}
+	}
+	return true
+}
+
+// SplitFormat splits a format like "markdown+smart-raw_html" into its base
+// name and the names of the extensions it toggles
+func SplitFormat(format string) (string, []string) {
+	end := strings.IndexAny(format, "+-")
+	if end < 0 {
+		return format, nil
+	}
+
+	base := format[:end]
+	var extensions []string
+	rest := format[end:]
+	for len(rest) > 0 {
+		rest = rest[1:]
+		next := strings.IndexAny(rest, "+-")
+		if next < 0 {
+			next = len(rest)
+		}
+		if name := rest[:next]; name != "" {
+			extensions = append(extensions, name)
+		}
+		rest = rest[next:]
+	}
+	return base, extensions
+}
+
+// toSet converts a list of names to a lookup set
+func toSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
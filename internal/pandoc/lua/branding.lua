@@ -0,0 +1,31 @@
+-- Adds the branding header and footer passed in the branding-header and
+-- branding-footer metadata fields. The fields hold markdown, so branding
+-- looks the same whatever the input and output formats are.
+
+local function branding_blocks(meta, key)
+  local value = meta[key]
+  if value == nil then
+    return {}
+  end
+  return pandoc.read(pandoc.utils.stringify(value), 'markdown').blocks
+end
+
+function Pandoc(doc)
+  local header = branding_blocks(doc.meta, 'branding-header')
+  local footer = branding_blocks(doc.meta, 'branding-footer')
+  doc.meta['branding-header'] = nil
+  doc.meta['branding-footer'] = nil
+
+  local blocks = {}
+  for _, block in ipairs(header) do
+    table.insert(blocks, block)
+  end
+  for _, block in ipairs(doc.blocks) do
+    table.insert(blocks, block)
+  end
+  for _, block in ipairs(footer) do
+    table.insert(blocks, block)
+  end
+  doc.blocks = blocks
+  return doc
+end
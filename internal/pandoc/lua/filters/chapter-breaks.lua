@@ -0,0 +1,73 @@
+-- Starts every level-1 heading after the first on a new page, for books
+-- assembled from several chapter files. LaTeX and PDF output get chapters
+-- from --top-level-division=chapter, which already start on new pages, and
+-- EPUB splits chapters into separate files.
+-- When the cover-image metadata field is set, the image is placed on a page
+-- of its own before the first chapter; EPUB shows it as the cover instead.
+-- A cover inside the resource path is loaded into the media bag, where the
+-- writers find it even under --sandbox, which keeps pandoc from reading it.
+
+local function page_break()
+  if FORMAT == 'docx' then
+    return pandoc.RawBlock('openxml', '<w:p><w:r><w:br w:type="page"/></w:r></w:p>')
+  elseif FORMAT == 'odt' then
+    return pandoc.RawBlock('opendocument', '<text:p text:style-name="Pagebreak"/>')
+  elseif FORMAT:match('^html') then
+    return pandoc.RawBlock('html', '<div style="break-after: page; page-break-after: always;"></div>')
+  end
+  return nil
+end
+
+-- embed_cover adds an absolute cover path that lies in a resource path
+-- directory to the media bag under that path
+local function embed_cover(src)
+  if not pandoc.path.is_absolute(src) or pandoc.mediabag.lookup(src) then
+    return
+  end
+  for part in src:gmatch('[^/\\]+') do
+    if part == '..' then
+      return
+    end
+  end
+  for _, dir in ipairs(PANDOC_STATE.resource_path) do
+    if not pandoc.path.is_absolute(pandoc.path.make_relative(src, dir)) then
+      local f = io.open(src, 'rb')
+      if f then
+        local contents = f:read('a')
+        f:close()
+        pandoc.mediabag.insert(src, nil, contents)
+      end
+      return
+    end
+  end
+end
+
+function Pandoc(doc)
+  local page = page_break()
+  local blocks = pandoc.List()
+
+  local cover = doc.meta['cover-image']
+  if cover then
+    embed_cover(pandoc.utils.stringify(cover))
+  end
+  if cover and not FORMAT:match('^epub') then
+    blocks:insert(pandoc.Para({ pandoc.Image({}, pandoc.utils.stringify(cover)) }))
+    if page then
+      blocks:insert(page)
+    end
+  end
+
+  local seen_chapter = false
+  for _, block in ipairs(doc.blocks) do
+    if block.t == 'Header' and block.level == 1 then
+      if seen_chapter and page then
+        blocks:insert(page)
+      end
+      seen_chapter = true
+    end
+    blocks:insert(block)
+  end
+
+  doc.blocks = blocks
+  return doc
+end
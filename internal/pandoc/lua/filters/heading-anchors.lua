@@ -0,0 +1,54 @@
+-- Normalises heading identifiers to lowercase ASCII slugs (e.g. "Getting_Started"
+-- becomes "getting-started"), makes them unique and updates in-document links
+-- that pointed at the old identifiers.
+
+local renamed = {}
+local used = {}
+
+local function slugify(text)
+  local slug = text:lower()
+    :gsub('[^%w%s%-_]', '')
+    :gsub('[%s_]+', '-')
+    :gsub('%-+', '-')
+    :gsub('^%-', '')
+    :gsub('%-$', '')
+  if slug == '' then
+    slug = 'section'
+  end
+  return slug
+end
+
+local function unique(slug)
+  local candidate = slug
+  local n = 1
+  while used[candidate] do
+    candidate = slug .. '-' .. n
+    n = n + 1
+  end
+  used[candidate] = true
+  return candidate
+end
+
+function Header(header)
+  local old = header.identifier
+  local source = old ~= '' and old or pandoc.utils.stringify(header.content)
+  local new = unique(slugify(source))
+  if old ~= '' then
+    renamed[old] = new
+  end
+  header.identifier = new
+  return header
+end
+
+function Link(link)
+  local id = link.target:match('^#(.+)$')
+  if id and renamed[id] then
+    link.target = '#' .. renamed[id]
+    return link
+  end
+end
+
+return {
+  { Header = Header },
+  { Link = Link },
+}
@@ -0,0 +1,60 @@
+-- Rewrites relative links between source documents to point at the converted
+-- files, e.g. other.md#anchor becomes other.html#anchor for HTML output.
+-- The target extension can be set with the relative-link-extension metadata
+-- field; otherwise it is derived from the output format. The
+-- relative-link-sources field, e.g. "md, markdown", limits the rewritten links
+-- to those extensions, so links to files that are not converted stay intact.
+
+local source_extensions = {
+  md = true, markdown = true, mkd = true, rst = true, adoc = true,
+  asciidoc = true, org = true, txt = true, tex = true, docx = true, odt = true,
+}
+
+local format_extensions = {
+  html = 'html', html4 = 'html', html5 = 'html', revealjs = 'html',
+  chunkedhtml = 'html', epub = 'xhtml', epub2 = 'xhtml', epub3 = 'xhtml',
+  latex = 'tex', beamer = 'tex', pdf = 'pdf', docx = 'docx', odt = 'odt',
+  markdown = 'md', gfm = 'md', commonmark = 'md', commonmark_x = 'md',
+  rst = 'rst', asciidoc = 'adoc', org = 'org', plain = 'txt', typst = 'typ',
+}
+
+local target_extension = format_extensions[FORMAT] or FORMAT
+
+local function rewrite(target)
+  -- Leave absolute URLs, absolute paths and in-document anchors alone
+  if target:match('^%a[%w+.-]*:') or target:match('^/') or target:match('^#') then
+    return nil
+  end
+
+  local path, fragment = target:match('^([^#?]*)(.*)$')
+  local base, extension = path:match('^(.*)%.([%w]+)$')
+  if base == nil or not source_extensions[extension:lower()] then
+    return nil
+  end
+  return base .. '.' .. target_extension .. fragment
+end
+
+function Meta(meta)
+  if meta['relative-link-extension'] then
+    target_extension = pandoc.utils.stringify(meta['relative-link-extension']):gsub('^%.', '')
+  end
+  if meta['relative-link-sources'] then
+    source_extensions = {}
+    for extension in pandoc.utils.stringify(meta['relative-link-sources']):gmatch('[%w]+') do
+      source_extensions[extension:lower()] = true
+    end
+  end
+end
+
+function Link(link)
+  local target = rewrite(link.target)
+  if target then
+    link.target = target
+    return link
+  end
+end
+
+return {
+  { Meta = Meta },
+  { Link = Link },
+}
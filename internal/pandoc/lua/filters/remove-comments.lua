@@ -0,0 +1,42 @@
+-- Removes internal comments: raw HTML comments (<!-- ... -->) and
+-- divs or spans with the "comment" or "internal" class.
+
+local hidden_classes = { comment = true, internal = true }
+
+local function is_html_comment(raw)
+  return (raw.format == 'html' or raw.format == 'markdown')
+    and raw.text:match('^%s*<!%-%-') ~= nil
+end
+
+local function is_hidden(el)
+  for _, class in ipairs(el.classes) do
+    if hidden_classes[class] then
+      return true
+    end
+  end
+  return false
+end
+
+function RawBlock(raw)
+  if is_html_comment(raw) then
+    return {}
+  end
+end
+
+function RawInline(raw)
+  if is_html_comment(raw) then
+    return {}
+  end
+end
+
+function Div(div)
+  if is_hidden(div) then
+    return {}
+  end
+end
+
+function Span(span)
+  if is_hidden(span) then
+    return {}
+  end
+end
@@ -0,0 +1,79 @@
+-- Keeps documents from making pandoc, or the TeX engine behind PDF output,
+-- read files outside the resource path.
+-- Images with absolute or parent-relative local paths are replaced by their
+-- description, and so are remote images unless the resource-guard-remote
+-- metadata field is true. Raw TeX is removed, as commands like \input or
+-- \includegraphics would read any file the engine can open.
+-- When the resource-guard-embed metadata field is true, pandoc runs with
+-- --sandbox and cannot read images from the resource path itself, so the
+-- remaining local images are loaded into the media bag here.
+
+local raw_tex_formats = { tex = true, latex = true, context = true }
+
+local function is_unsafe_local(src)
+  if src:match('^file:') or src:match('^[/\\]') or src:match('^%a:[/\\]') or src:match('^~') then
+    return true
+  end
+  for part in src:gmatch('[^/\\]+') do
+    if part == '..' then
+      return true
+    end
+  end
+  return false
+end
+
+local function is_remote(src)
+  return src:match('^%a[%w+.-]*:') ~= nil
+end
+
+local function flag(meta, key)
+  local value = meta[key]
+  meta[key] = nil
+  return value == true or pandoc.utils.stringify(value or '') == 'true'
+end
+
+-- embed_image reads a relative image from the first resource path directory
+-- that has it and adds it to the media bag under its source path
+local function embed_image(src)
+  if pandoc.mediabag.lookup(src) then
+    return
+  end
+  local path = src:gsub('[?#].*$', '')
+  for _, dir in ipairs(PANDOC_STATE.resource_path) do
+    local f = io.open(pandoc.path.join({ dir, path }), 'rb')
+    if f then
+      local contents = f:read('a')
+      f:close()
+      pandoc.mediabag.insert(src, nil, contents)
+      return
+    end
+  end
+end
+
+local function drop_raw_tex(raw)
+  if raw_tex_formats[raw.format:lower()] then
+    return {}
+  end
+end
+
+function Pandoc(doc)
+  local allow_remote = flag(doc.meta, 'resource-guard-remote')
+  local embed = flag(doc.meta, 'resource-guard-embed')
+
+  return doc:walk({
+    Image = function(img)
+      local src = img.src
+      if src:match('^data:') then
+        return nil
+      end
+      if is_unsafe_local(src) or (is_remote(src) and not allow_remote) then
+        return img.caption
+      end
+      if embed and not is_remote(src) then
+        embed_image(src)
+      end
+    end,
+    RawBlock = drop_raw_tex,
+    RawInline = drop_raw_tex,
+  })
+end
@@ -0,0 +1,97 @@
+package pandoc
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// registryNamePattern restricts names in the template and filter registries
+// so they cannot escape the registry directory
+var registryNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// namedFiles is a directory of files addressed by name, the file name without
+// its extension. The template, filter and citation style registries are built
+// on it.
+type namedFiles struct {
+	dir     string
+	pattern *regexp.Regexp
+}
+
+// namedFile is one file of a namedFiles directory
+type namedFile struct {
+	Name  string
+	Ext   string
+	Path  string
+	Entry fs.DirEntry
+}
+
+// newNamedFiles creates a namedFiles for dir accepting names that match pattern
+func newNamedFiles(dir string, pattern *regexp.Regexp) namedFiles {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return namedFiles{dir: dir, pattern: pattern}
+}
+
+// namedFilesFromEnv creates a namedFiles for the directory in the envVar
+// environment variable, or for defaultDir found by dataPath when it is unset
+func namedFilesFromEnv(envVar, defaultDir string, pattern *regexp.Regexp) namedFiles {
+	dir := os.Getenv(envVar)
+	if dir == "" {
+		dir = dataPath(defaultDir)
+	}
+	return newNamedFiles(dir, pattern)
+}
+
+// Dir returns the registry directory
+func (n namedFiles) Dir() string {
+	return n.dir
+}
+
+// validName checks that name can be looked up in the directory
+func (n namedFiles) validName(name string) bool {
+	return n.pattern.MatchString(name) && !strings.Contains(name, "..")
+}
+
+// list returns the visible files of the directory whose names are valid,
+// sorted by file name. A missing directory yields an empty list.
+func (n namedFiles) list() ([]namedFile, error) {
+	entries, err := os.ReadDir(n.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %v", n.dir, err)
+	}
+
+	var files []namedFile
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		ext := filepath.Ext(entry.Name())
+		name := strings.TrimSuffix(entry.Name(), ext)
+		if !n.validName(name) {
+			continue
+		}
+		files = append(files, namedFile{Name: name, Ext: ext, Path: filepath.Join(n.dir, entry.Name()), Entry: entry})
+	}
+	return files, nil
+}
+
+// dataPath resolves a path shipped with the server, such as the templates
+// directory, relative to the executable directory, falling back to the
+// current directory
+func dataPath(relPath string) string {
+	if execPath, err := os.Executable(); err == nil {
+		path := filepath.Join(filepath.Dir(execPath), relPath)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return relPath
+}
@@ -0,0 +1,266 @@
+package pandoc
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Options holds per-request conversion settings. Only the fields below can
+// be turned into pandoc flags, so clients cannot pass arbitrary arguments.
+type Options struct {
+	// Branding overrides the deployment branding default when not nil
+	Branding *bool
+	// Template is the name of a template from the template registry
+	Template string
+	// Filters are names of registered filters, run in the given order
+	Filters []string
+
+	// Bibliography is a BibTeX, CSL JSON, CSL YAML or RIS file
+	Bibliography string
+	// References are inline CSL JSON items, each with an "id"
+	References []map[string]any
+	// CSL is the name of a citation style from the styles directory
+	CSL              string
+	LinkCitations    bool
+	LinkBibliography bool
+
+	// OnExists is the policy for an existing output file, overwrite by default
+	OnExists string
+
+	// NoCache runs pandoc even when the conversion is cached, replacing the
+	// cached document
+	NoCache bool
+
+	// FileScope parses each input file on its own, so footnotes and
+	// identifiers of different chapters cannot clash
+	FileScope bool
+	// TopLevelDivision makes level-1 headings sections, chapters or parts
+	TopLevelDivision string
+	// Authors are the document authors, for more than one author
+	Authors []string
+	// CoverImage is an image placed before the first chapter, or the EPUB
+	// cover. It is set by the server after checking the path, never by
+	// clients through metadata.
+	CoverImage string
+
+	// AllowRemoteResources lets pandoc fetch remote images, if the server allows it
+	AllowRemoteResources bool
+	// ResourcePath lists the directories pandoc looks for images in. It is
+	// set by the server from the allowed roots, never by clients.
+	ResourcePath []string
+
+	TOC               bool
+	TOCDepth          int
+	Standalone        bool
+	NumberSections    bool
+	Metadata          map[string]string
+	Variables         map[string]string
+	HighlightStyle    string
+	Wrap              string
+	Columns           int
+	EOL               string
+	ShiftHeadingLevel int
+}
+
+// Allowed values of enumerated options
+var (
+	wrapModes = []string{"auto", "none", "preserve"}
+	eolModes  = []string{"crlf", "lf", "native"}
+	// topLevelDivisions are the values of --top-level-division
+	topLevelDivisions = []string{"default", "section", "chapter", "part"}
+)
+
+var (
+	// optionKeyPattern restricts metadata and variable names
+	optionKeyPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+	// highlightStylePattern accepts built-in style names, not theme file paths
+	highlightStylePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+)
+
+// restrictedKeys make pandoc read local files, inject raw code into the
+// output, switch the resource guard or replace the server-configured
+// branding, so they cannot be set through metadata or variables
+var restrictedKeys = map[string]bool{
+	"header-includes":        true,
+	"include-before":         true,
+	"include-after":          true,
+	"include-before-body":    true,
+	"include-after-body":     true,
+	"include-in-header":      true,
+	"bibliography":           true,
+	"csl":                    true,
+	"citation-abbreviations": true,
+	"css":                    true,
+	"template":               true,
+	"reference-doc":          true,
+	"epub-cover-image":       true,
+	"cover-image":            true,
+	"resource-path":          true,
+	"branding-header":        true,
+	"branding-footer":        true,
+	"resource-guard-remote":  true,
+	"resource-guard-embed":   true,
+}
+
+// OptionError reports an invalid conversion option
+type OptionError struct {
+	Option string `json:"option"`
+	Reason string `json:"reason"`
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("invalid option %s: %s", e.Option, e.Reason)
+}
+
+func (e *OptionError) Kind() string { return ErrorInvalidOption }
+
+func (e *OptionError) Hint() string {
+	return fmt.Sprintf("Fix the %s option and call the tool again.", e.Option)
+}
+
+// Validate checks every option against its allowed values
+func (o Options) Validate() error {
+	if o.TOCDepth != 0 && (o.TOCDepth < 1 || o.TOCDepth > 6) {
+		return &OptionError{Option: "toc_depth", Reason: "must be between 1 and 6"}
+	}
+	if o.Columns != 0 && (o.Columns < 1 || o.Columns > 1000) {
+		return &OptionError{Option: "columns", Reason: "must be between 1 and 1000"}
+	}
+	if o.ShiftHeadingLevel < -5 || o.ShiftHeadingLevel > 5 {
+		return &OptionError{Option: "shift_heading_level", Reason: "must be between -5 and 5"}
+	}
+	if o.Wrap != "" && !contains(wrapModes, o.Wrap) {
+		return &OptionError{Option: "wrap", Reason: "must be one of " + strings.Join(wrapModes, ", ")}
+	}
+	if o.EOL != "" && !contains(eolModes, o.EOL) {
+		return &OptionError{Option: "eol", Reason: "must be one of " + strings.Join(eolModes, ", ")}
+	}
+	if o.OnExists != "" && !contains(onExistsModes, o.OnExists) {
+		return &OptionError{Option: "on_exists", Reason: "must be one of " + strings.Join(onExistsModes, ", ")}
+	}
+	if o.TopLevelDivision != "" && !contains(topLevelDivisions, o.TopLevelDivision) {
+		return &OptionError{Option: "top_level_division", Reason: "must be one of " + strings.Join(topLevelDivisions, ", ")}
+	}
+	if o.HighlightStyle != "" && !highlightStylePattern.MatchString(o.HighlightStyle) {
+		return &OptionError{Option: "highlight_style", Reason: "must be the name of a built-in style"}
+	}
+
+	for i, ref := range o.References {
+		if id, _ := ref["id"].(string); id == "" {
+			return &OptionError{Option: fmt.Sprintf("references[%d]", i), Reason: "must have a string id"}
+		}
+	}
+
+	for key := range o.Metadata {
+		if err := validateOptionKey("metadata", key); err != nil {
+			return err
+		}
+	}
+	for key, value := range o.Variables {
+		if err := validateOptionKey("variables", key); err != nil {
+			return err
+		}
+		// Variables are inserted into templates verbatim, so a backslash
+		// could smuggle LaTeX commands such as \input into PDF builds
+		if strings.ContainsAny(value, "\\\n\r") {
+			return &OptionError{Option: "variables." + key, Reason: "value must not contain backslashes or line breaks"}
+		}
+	}
+
+	return nil
+}
+
+// validateOptionKey checks a metadata or variable name
+func validateOptionKey(option, key string) error {
+	if !optionKeyPattern.MatchString(key) {
+		return &OptionError{Option: option, Reason: fmt.Sprintf("invalid name %q", key)}
+	}
+	if restrictedKeys[strings.ToLower(key)] {
+		return &OptionError{Option: option, Reason: fmt.Sprintf("%q cannot be set", key)}
+	}
+	return nil
+}
+
+// Args validates the options and converts them to pandoc arguments
+func (o Options) Args() ([]string, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	var args []string
+	if o.Standalone {
+		args = append(args, "--standalone")
+	}
+	if o.TOC {
+		args = append(args, "--toc")
+	}
+	if o.TOCDepth != 0 {
+		args = append(args, "--toc-depth="+strconv.Itoa(o.TOCDepth))
+	}
+	if o.NumberSections {
+		args = append(args, "--number-sections")
+	}
+	if o.ShiftHeadingLevel != 0 {
+		args = append(args, "--shift-heading-level-by="+strconv.Itoa(o.ShiftHeadingLevel))
+	}
+	if o.HighlightStyle != "" {
+		args = append(args, "--highlight-style="+o.HighlightStyle)
+	}
+	if o.Wrap != "" {
+		args = append(args, "--wrap="+o.Wrap)
+	}
+	if o.Columns != 0 {
+		args = append(args, "--columns="+strconv.Itoa(o.Columns))
+	}
+	if o.EOL != "" {
+		args = append(args, "--eol="+o.EOL)
+	}
+	if o.FileScope {
+		args = append(args, "--file-scope")
+	}
+	if o.TopLevelDivision != "" {
+		args = append(args, "--top-level-division="+o.TopLevelDivision)
+	}
+
+	// Sorted keys keep the command line deterministic
+	for _, key := range sortedKeys(o.Metadata) {
+		args = append(args, "--metadata", key+"="+o.Metadata[key])
+	}
+	// A repeated key makes a list
+	for _, author := range o.Authors {
+		args = append(args, "--metadata", "author="+author)
+	}
+	for _, key := range sortedKeys(o.Variables) {
+		args = append(args, "--variable", key+"="+o.Variables[key])
+	}
+
+	return args, nil
+}
+
+// citations checks if the options ask for citation processing
+func (o Options) citations() bool {
+	return o.Bibliography != "" || len(o.References) > 0 || o.CSL != "" || o.LinkCitations || o.LinkBibliography
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// contains checks if values includes value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
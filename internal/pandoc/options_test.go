@@ -0,0 +1,40 @@
+package pandoc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateRestrictedKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{name: "ordinary metadata", opts: Options{Metadata: map[string]string{"title": "T"}}},
+		{name: "ordinary variable", opts: Options{Variables: map[string]string{"fontsize": "12pt"}}},
+		{name: "branding header metadata", opts: Options{Metadata: map[string]string{"branding-header": "x"}}, wantErr: true},
+		{name: "branding footer metadata", opts: Options{Metadata: map[string]string{"branding-footer": "x"}}, wantErr: true},
+		{name: "branding footer in another case", opts: Options{Metadata: map[string]string{"Branding-Footer": "x"}}, wantErr: true},
+		{name: "branding header variable", opts: Options{Variables: map[string]string{"branding-header": "x"}}, wantErr: true},
+		{name: "header includes", opts: Options{Metadata: map[string]string{"header-includes": "x"}}, wantErr: true},
+		{name: "resource guard switch", opts: Options{Metadata: map[string]string{"resource-guard-remote": "true"}}, wantErr: true},
+		{name: "cover image", opts: Options{Metadata: map[string]string{"cover-image": "/etc/passwd"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want no error", err)
+				}
+				return
+			}
+			var optionErr *OptionError
+			if !errors.As(err, &optionErr) {
+				t.Fatalf("Validate() = %v, want an OptionError", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package pandoc
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Policies for an output file that already exists
+const (
+	// OnExistsOverwrite replaces the existing file
+	OnExistsOverwrite = "overwrite"
+	// OnExistsFail keeps the existing file and fails the conversion
+	OnExistsFail = "fail"
+	// OnExistsRename writes to a new name with a numeric suffix, e.g. report-1.docx
+	OnExistsRename = "rename"
+	// OnExistsBackup renames the existing file to <name>.bak, or <name>.bak.1,
+	// <name>.bak.2, ... when that exists too, before replacing it
+	OnExistsBackup = "backup"
+)
+
+// onExistsModes lists the accepted policies
+var onExistsModes = []string{OnExistsOverwrite, OnExistsFail, OnExistsRename, OnExistsBackup}
+
+// maxRenameAttempts bounds the search for a free file name
+const maxRenameAttempts = 1000
+
+// OutputExistsError reports an existing output file under the fail policy
+type OutputExistsError struct {
+	Path string `json:"path"`
+}
+
+func (e *OutputExistsError) Error() string {
+	return fmt.Sprintf("output file already exists: %s", e.Path)
+}
+
+func (e *OutputExistsError) Kind() string { return ErrorOutputExists }
+
+func (e *OutputExistsError) Hint() string {
+	return "Pass on_exists overwrite, rename or backup to write anyway, or choose another output_file."
+}
+
+// createOutputTemp creates the temporary file pandoc writes to, next to
+// outputFile so the final rename stays on one filesystem. It keeps the
+// extension because some writers, such as chunkedhtml, depend on it.
+func createOutputTemp(outputFile string) (string, error) {
+	dir, base := filepath.Split(outputFile)
+	ext := filepath.Ext(base)
+	f, err := os.CreateTemp(dir, "."+strings.TrimSuffix(base, ext)+".*.tmp"+ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary output file: %v", err)
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// checkOutputFile fails early under the fail policy, before pandoc runs
+func checkOutputFile(outputFile, onExists string) error {
+	if onExists != OnExistsFail {
+		return nil
+	}
+	if _, err := os.Lstat(outputFile); err == nil {
+		return &OutputExistsError{Path: outputFile}
+	}
+	return nil
+}
+
+// commitOutput moves the finished temporary file to outputFile according to
+// the onExists policy and returns the path actually written
+func commitOutput(tmpPath, outputFile, onExists string) (string, error) {
+	mode := fs.FileMode(0644)
+	existing, err := os.Stat(outputFile)
+	exists := err == nil
+	if exists {
+		mode = existing.Mode().Perm()
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		return "", fmt.Errorf("failed to set output file permissions: %v", err)
+	}
+
+	switch onExists {
+	case OnExistsFail:
+		if err := linkNoReplace(tmpPath, outputFile); err != nil {
+			return "", err
+		}
+		return outputFile, nil
+
+	case OnExistsRename:
+		ext := filepath.Ext(outputFile)
+		stem := strings.TrimSuffix(outputFile, ext)
+		candidate := outputFile
+		for i := 1; i <= maxRenameAttempts; i++ {
+			err := linkNoReplace(tmpPath, candidate)
+			if err == nil {
+				return candidate, nil
+			}
+			var existsErr *OutputExistsError
+			if !errors.As(err, &existsErr) {
+				return "", err
+			}
+			candidate = stem + "-" + strconv.Itoa(i) + ext
+		}
+		return "", fmt.Errorf("no free file name for %s after %d attempts", outputFile, maxRenameAttempts)
+
+	case OnExistsBackup:
+		if exists {
+			backup, err := backupOutput(outputFile)
+			if err != nil {
+				return "", err
+			}
+			if err := os.Rename(tmpPath, outputFile); err != nil {
+				// Put the original back rather than leave no file at all
+				os.Rename(backup, outputFile)
+				return "", fmt.Errorf("failed to move output file into place: %v", err)
+			}
+			return outputFile, nil
+		}
+	}
+
+	if err := os.Rename(tmpPath, outputFile); err != nil {
+		return "", fmt.Errorf("failed to move output file into place: %v", err)
+	}
+	return outputFile, nil
+}
+
+// backupOutput moves outputFile to the first free backup name, keeping
+// earlier backups, and returns that name
+func backupOutput(outputFile string) (string, error) {
+	candidate := outputFile + ".bak"
+	for i := 1; i <= maxRenameAttempts; i++ {
+		err := linkNoReplace(outputFile, candidate)
+		if err == nil {
+			return candidate, nil
+		}
+		var existsErr *OutputExistsError
+		if !errors.As(err, &existsErr) {
+			return "", fmt.Errorf("failed to back up existing output file: %v", err)
+		}
+		candidate = outputFile + ".bak." + strconv.Itoa(i)
+	}
+	return "", fmt.Errorf("no free backup name for %s after %d attempts", outputFile, maxRenameAttempts)
+}
+
+// linkNoReplace puts tmpPath at path unless path already exists. A hard link
+// makes the check and the write one atomic step; filesystems without hard
+// links fall back to a check followed by a rename.
+func linkNoReplace(tmpPath, path string) error {
+	err := os.Link(tmpPath, path)
+	switch {
+	case err == nil:
+		os.Remove(tmpPath)
+		return nil
+	case errors.Is(err, fs.ErrExist):
+		return &OutputExistsError{Path: path}
+	}
+
+	if _, statErr := os.Lstat(path); statErr == nil {
+		return &OutputExistsError{Path: path}
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to move output file into place: %v", err)
+	}
+	return nil
+}
+
+// WriteOutputFile atomically writes content to outputFile according to the
+// onExists policy and returns the path actually written
+func WriteOutputFile(content []byte, outputFile, onExists string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %v", err)
+	}
+	if err := checkOutputFile(outputFile, onExists); err != nil {
+		return "", err
+	}
+
+	tmpPath, err := createOutputTemp(outputFile)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpPath)
+
+	if err := os.WriteFile(tmpPath, content, 0600); err != nil {
+		return "", fmt.Errorf("failed to write output file: %v", err)
+	}
+	return commitOutput(tmpPath, outputFile, onExists)
+}
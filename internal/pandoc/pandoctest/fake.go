@@ -0,0 +1,210 @@
+// Package pandoctest provides a scriptable pandoc.Converter for exercising
+// the tool handlers without a pandoc executable.
+package pandoctest
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+)
+
+// Conversion methods of pandoc.Converter, as recorded in Call.Method
+const (
+	MethodConvertString       = "ConvertString"
+	MethodConvertFile         = "ConvertFile"
+	MethodConvertFiles        = "ConvertFiles"
+	MethodConvertStringToFile = "ConvertStringToFile"
+	MethodConvertBytes        = "ConvertBytes"
+)
+
+// Call records one conversion requested from a Fake
+type Call struct {
+	Method    string
+	Content   []byte
+	InputFile string
+	// InputFiles are the files of ConvertFiles
+	InputFiles   []string
+	InputFormat  string
+	OutputFormat string
+	OutputFile   string
+	Options      pandoc.Options
+}
+
+// Fake is a pandoc.Converter that records its calls and answers them as
+// scripted. The zero value accepts every format and "converts" by copying
+// the input unchanged, concatenating several input files.
+type Fake struct {
+	// InputFormats and OutputFormats restrict the accepted formats; nil
+	// accepts all
+	InputFormats  []string
+	OutputFormats []string
+	// Output replaces the converted document when not nil
+	Output []byte
+	// Warnings are reported with every successful conversion
+	Warnings []pandoc.Warning
+	// Err fails every conversion when not nil
+	Err error
+	// Convert, when set, produces the result of every conversion instead of
+	// Output, Warnings and Err. The fake still writes the output file.
+	Convert func(ctx context.Context, call Call) (*pandoc.Result, error)
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ pandoc.Converter = (*Fake)(nil)
+
+// NewFake creates a fake returning output for every conversion
+func NewFake(output string) *Fake {
+	return &Fake{Output: []byte(output)}
+}
+
+// Calls returns the conversions requested so far
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// LastCall returns the latest conversion, false if there was none
+func (f *Fake) LastCall() (Call, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.calls) == 0 {
+		return Call{}, false
+	}
+	return f.calls[len(f.calls)-1], true
+}
+
+// ValidateInputFormat implements pandoc.Converter
+func (f *Fake) ValidateInputFormat(format string) bool {
+	return f.InputFormats == nil || contains(f.InputFormats, format)
+}
+
+// ValidateOutputFormat implements pandoc.Converter
+func (f *Fake) ValidateOutputFormat(format string) bool {
+	return f.OutputFormats == nil || contains(f.OutputFormats, format)
+}
+
+// ConvertString implements pandoc.Converter
+func (f *Fake) ConvertString(ctx context.Context, content, inputFormat, outputFormat string, opts pandoc.Options) (*pandoc.Result, error) {
+	return f.run(ctx, Call{
+		Method:       MethodConvertString,
+		Content:      []byte(content),
+		InputFormat:  inputFormat,
+		OutputFormat: outputFormat,
+		Options:      opts,
+	})
+}
+
+// ConvertFile implements pandoc.Converter
+func (f *Fake) ConvertFile(ctx context.Context, inputFile, inputFormat, outputFormat, outputFile string, opts pandoc.Options) (*pandoc.Result, error) {
+	return f.run(ctx, Call{
+		Method:       MethodConvertFile,
+		InputFile:    inputFile,
+		InputFormat:  inputFormat,
+		OutputFormat: outputFormat,
+		OutputFile:   outputFile,
+		Options:      opts,
+	})
+}
+
+// ConvertFiles implements pandoc.Converter
+func (f *Fake) ConvertFiles(ctx context.Context, inputFiles []string, inputFormat, outputFormat, outputFile string, opts pandoc.Options) (*pandoc.Result, error) {
+	return f.run(ctx, Call{
+		Method:       MethodConvertFiles,
+		InputFiles:   append([]string(nil), inputFiles...),
+		InputFormat:  inputFormat,
+		OutputFormat: outputFormat,
+		OutputFile:   outputFile,
+		Options:      opts,
+	})
+}
+
+// ConvertStringToFile implements pandoc.Converter
+func (f *Fake) ConvertStringToFile(ctx context.Context, content, inputFormat, outputFormat, outputFile string, opts pandoc.Options) (*pandoc.Result, error) {
+	return f.run(ctx, Call{
+		Method:       MethodConvertStringToFile,
+		Content:      []byte(content),
+		InputFormat:  inputFormat,
+		OutputFormat: outputFormat,
+		OutputFile:   outputFile,
+		Options:      opts,
+	})
+}
+
+// ConvertBytes implements pandoc.Converter
+func (f *Fake) ConvertBytes(ctx context.Context, content []byte, inputFormat, outputFormat, outputFile string, opts pandoc.Options) (*pandoc.Result, error) {
+	return f.run(ctx, Call{
+		Method:       MethodConvertBytes,
+		Content:      content,
+		InputFormat:  inputFormat,
+		OutputFormat: outputFormat,
+		OutputFile:   outputFile,
+		Options:      opts,
+	})
+}
+
+// run records call and answers it, writing the output file like pandoc would
+func (f *Fake) run(ctx context.Context, call Call) (*pandoc.Result, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var result *pandoc.Result
+	if f.Convert != nil {
+		var err error
+		if result, err = f.Convert(ctx, call); err != nil {
+			return nil, err
+		}
+	} else {
+		if f.Err != nil {
+			return nil, f.Err
+		}
+		output := f.Output
+		if output == nil {
+			output = call.Content
+			inputFiles := call.InputFiles
+			if call.InputFile != "" {
+				inputFiles = []string{call.InputFile}
+			}
+			if len(inputFiles) > 0 {
+				output = nil
+			}
+			// Files are concatenated, as pandoc does with several inputs
+			for _, inputFile := range inputFiles {
+				data, err := os.ReadFile(inputFile)
+				if err != nil {
+					return nil, &pandoc.InputNotFoundError{Path: inputFile}
+				}
+				output = append(output, data...)
+			}
+		}
+		result = &pandoc.Result{Output: output, Warnings: f.Warnings}
+	}
+
+	if call.OutputFile == "" || result.OutputFile != "" {
+		return result, nil
+	}
+	path, err := pandoc.WriteOutputFile(result.Output, call.OutputFile, call.Options.OnExists)
+	if err != nil {
+		return nil, err
+	}
+	return &pandoc.Result{OutputFile: path, Warnings: result.Warnings}, nil
+}
+
+// contains checks if list includes value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
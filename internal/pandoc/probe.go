@@ -0,0 +1,180 @@
+package pandoc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Pandoc versions that introduced the features the server depends on
+var (
+	sandboxVersion     = []int{2, 15}
+	chunkedHTMLVersion = []int{3, 0}
+	typstVersion       = []int{3, 1, 2}
+)
+
+// versionPattern matches the first line of pandoc --version, e.g. "pandoc 3.1.11"
+var versionPattern = regexp.MustCompile(`^pandoc(?:\.exe)?\s+(\d+(?:\.\d+)*)`)
+
+// Features are the optional pandoc abilities the server adapts to
+type Features struct {
+	// Sandbox is the --sandbox option
+	Sandbox bool `json:"sandbox"`
+	// Typst is the typst writer
+	Typst bool `json:"typst"`
+	// ChunkedHTML is the chunkedhtml writer
+	ChunkedHTML bool `json:"chunkedhtml"`
+}
+
+// String lists the available features, e.g. "sandbox, typst"
+func (f Features) String() string {
+	var names []string
+	if f.Sandbox {
+		names = append(names, "sandbox")
+	}
+	if f.Typst {
+		names = append(names, "typst")
+	}
+	if f.ChunkedHTML {
+		names = append(names, "chunkedhtml")
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// Probe is what the server learned about a pandoc executable when it was
+// first used
+type Probe struct {
+	// Path is the executable
+	Path string `json:"path"`
+	// Version is the pandoc version, e.g. "3.1.11"
+	Version  string   `json:"version"`
+	Features Features `json:"features"`
+}
+
+// findPandoc returns the executable named by PANDOC_PATH, or pandoc from the
+// system PATH, after checking that it can be run
+func findPandoc() (string, error) {
+	// Try to get path from environment variable
+	pandocPath := os.Getenv("PANDOC_PATH")
+	if pandocPath == "" {
+		// If variable is not set, look for pandoc in system PATH
+		path, err := exec.LookPath("pandoc")
+		if err != nil {
+			return "", &PandocNotFoundError{Reason: "Pandoc not found in PATH, please set PANDOC_PATH environment variable"}
+		}
+		pandocPath = path
+	}
+
+	// Check that file exists and is executable
+	info, err := os.Stat(pandocPath)
+	if err != nil {
+		return "", &PandocNotFoundError{Path: pandocPath, Reason: fmt.Sprintf("error accessing Pandoc: %v", err)}
+	}
+
+	if info.IsDir() {
+		return "", &PandocNotFoundError{Path: pandocPath, Reason: "is a directory, not a Pandoc executable"}
+	}
+
+	// On Windows don't check execution permissions
+	if os.Getenv("OS") != "Windows_NT" && info.Mode()&0111 == 0 {
+		return "", &PandocNotFoundError{Path: pandocPath, Reason: "is not executable"}
+	}
+
+	return pandocPath, nil
+}
+
+// probePandoc runs pandoc --version and derives the features of that
+// version. The writers are confirmed against --list-output-formats when pandoc
+// can list them.
+func probePandoc(ctx context.Context, path string) (*Probe, error) {
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path, "--version")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, &PandocNotFoundError{Path: path, Reason: fmt.Sprintf("pandoc --version failed: %v %s", err, strings.TrimSpace(stderr.String()))}
+	}
+
+	firstLine, _, _ := strings.Cut(string(output), "\n")
+	m := versionPattern.FindStringSubmatch(strings.TrimSpace(firstLine))
+	if m == nil {
+		return nil, &PandocNotFoundError{Path: path, Reason: fmt.Sprintf("unexpected pandoc --version output: %q", firstLine)}
+	}
+
+	probe := &Probe{
+		Path:    path,
+		Version: m[1],
+		Features: Features{
+			Sandbox:     versionAtLeast(m[1], sandboxVersion),
+			Typst:       versionAtLeast(m[1], typstVersion),
+			ChunkedHTML: versionAtLeast(m[1], chunkedHTMLVersion),
+		},
+	}
+	if c, err := discoverCapabilities(ctx, path); err == nil {
+		probe.Features.Typst = c.SupportsOutput("typst")
+		probe.Features.ChunkedHTML = c.SupportsOutput("chunkedhtml")
+	}
+	return probe, nil
+}
+
+// versionAtLeast compares a dotted version with a minimum
+func versionAtLeast(version string, min []int) bool {
+	parts := strings.Split(version, ".")
+	for i, want := range min {
+		got := 0
+		if i < len(parts) {
+			got, _ = strconv.Atoi(parts[i])
+		}
+		if got != want {
+			return got > want
+		}
+	}
+	return true
+}
+
+// current returns the probe of the executable to run. The executable is
+// found and probed again when PANDOC_PATH changed since the last probe; a
+// failed probe is retried by the next call.
+func (p *PandocConverter) current() (*Probe, error) {
+	envPath := os.Getenv("PANDOC_PATH")
+
+	p.mu.RLock()
+	probe, probedFor := p.probe, p.envPath
+	p.mu.RUnlock()
+	if probe != nil && envPath == probedFor {
+		return probe, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.probe != nil && envPath == p.envPath {
+		return p.probe, nil
+	}
+
+	path, err := findPandoc()
+	if err != nil {
+		return nil, err
+	}
+	if probe, err = probePandoc(context.Background(), path); err != nil {
+		return nil, err
+	}
+	p.probe, p.envPath = probe, envPath
+	return probe, nil
+}
+
+// Probe returns the version and features of the pandoc executable in use,
+// probing it again if PANDOC_PATH changed
+func (p *PandocConverter) Probe() (*Probe, error) {
+	return p.current()
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package pandoc
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// configureProcessGroup starts pandoc in its own process group and makes
+// cancellation kill the whole group, including LaTeX engines it spawned
+func configureProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		if cmd.Process == nil {
+			return nil
+		}
+		// Negative pid addresses the process group
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
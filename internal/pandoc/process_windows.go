@@ -0,0 +1,23 @@
+//go:build windows
+
+package pandoc
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// configureProcessGroup makes cancellation kill pandoc together with its
+// child processes (e.g. the LaTeX engine used for PDF output)
+func configureProcessGroup(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		if cmd.Process == nil {
+			return nil
+		}
+		// taskkill /T terminates the whole process tree
+		if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+}
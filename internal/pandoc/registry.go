@@ -0,0 +1,309 @@
+package pandoc
+
+import (
+	"mime"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FormatInfo describes how a user-facing format maps to pandoc
+type FormatInfo struct {
+	// Name is the canonical user-facing name
+	Name string
+	// Reader is the pandoc reader used for input ("" if pandoc cannot read the format)
+	Reader string
+	// Writer is the pandoc writer used for output ("" if pandoc cannot write the format)
+	Writer string
+	// Extension is the default file extension without the leading dot
+	Extension string
+	// Binary is set for formats whose output is not text
+	Binary bool
+	// NeedsOutputFile is set when the output cannot be returned as a string
+	NeedsOutputFile bool
+}
+
+// knownFormats lists formats with mappings that differ from the pandoc defaults
+var knownFormats = []FormatInfo{
+	{Name: "markdown", Reader: "markdown", Writer: "markdown", Extension: "md"},
+	{Name: "gfm", Reader: "gfm", Writer: "gfm", Extension: "md"},
+	{Name: "commonmark", Reader: "commonmark", Writer: "commonmark", Extension: "md"},
+	{Name: "commonmark_x", Reader: "commonmark_x", Writer: "commonmark_x", Extension: "md"},
+	{Name: "markdown_strict", Reader: "markdown_strict", Writer: "markdown_strict", Extension: "md"},
+	{Name: "markdown_mmd", Reader: "markdown_mmd", Writer: "markdown_mmd", Extension: "md"},
+	{Name: "markdown_phpextra", Reader: "markdown_phpextra", Writer: "markdown_phpextra", Extension: "md"},
+	{Name: "html", Reader: "html", Writer: "html", Extension: "html"},
+	{Name: "html4", Reader: "html", Writer: "html4", Extension: "html"},
+	{Name: "html5", Reader: "html", Writer: "html5", Extension: "html"},
+	{Name: "revealjs", Writer: "revealjs", Extension: "html"},
+	{Name: "chunkedhtml", Writer: "chunkedhtml", Extension: "zip", Binary: true, NeedsOutputFile: true},
+	// Plain text has no pandoc reader, so it is read as markdown
+	{Name: "plain", Reader: "markdown", Writer: "plain", Extension: "txt"},
+	{Name: "pdf", Writer: "pdf", Extension: "pdf", Binary: true, NeedsOutputFile: true},
+	{Name: "docx", Reader: "docx", Writer: "docx", Extension: "docx", Binary: true, NeedsOutputFile: true},
+	{Name: "odt", Reader: "odt", Writer: "odt", Extension: "odt", Binary: true, NeedsOutputFile: true},
+	{Name: "pptx", Reader: "pptx", Writer: "pptx", Extension: "pptx", Binary: true, NeedsOutputFile: true},
+	{Name: "epub", Reader: "epub", Writer: "epub", Extension: "epub", Binary: true, NeedsOutputFile: true},
+	{Name: "epub2", Reader: "epub", Writer: "epub2", Extension: "epub", Binary: true, NeedsOutputFile: true},
+	{Name: "epub3", Reader: "epub", Writer: "epub3", Extension: "epub", Binary: true, NeedsOutputFile: true},
+	{Name: "latex", Reader: "latex", Writer: "latex", Extension: "tex"},
+	{Name: "beamer", Writer: "beamer", Extension: "tex"},
+	{Name: "context", Writer: "context", Extension: "tex"},
+	{Name: "rst", Reader: "rst", Writer: "rst", Extension: "rst"},
+	{Name: "asciidoc", Reader: "asciidoc", Writer: "asciidoc", Extension: "adoc"},
+	{Name: "typst", Reader: "typst", Writer: "typst", Extension: "typ"},
+	{Name: "org", Reader: "org", Writer: "org", Extension: "org"},
+	{Name: "ipynb", Reader: "ipynb", Writer: "ipynb", Extension: "ipynb"},
+	{Name: "textile", Reader: "textile", Writer: "textile", Extension: "textile"},
+	{Name: "mediawiki", Reader: "mediawiki", Writer: "mediawiki", Extension: "wiki"},
+	{Name: "dokuwiki", Reader: "dokuwiki", Writer: "dokuwiki", Extension: "txt"},
+	{Name: "docbook", Reader: "docbook", Writer: "docbook", Extension: "xml"},
+	{Name: "jats", Reader: "jats", Writer: "jats", Extension: "xml"},
+	{Name: "tei", Writer: "tei", Extension: "xml"},
+	{Name: "texinfo", Writer: "texinfo", Extension: "texi"},
+	{Name: "rtf", Reader: "rtf", Writer: "rtf", Extension: "rtf"},
+	{Name: "fb2", Reader: "fb2", Writer: "fb2", Extension: "fb2"},
+	{Name: "opml", Reader: "opml", Writer: "opml", Extension: "opml"},
+	{Name: "man", Reader: "man", Writer: "man", Extension: "man"},
+	{Name: "json", Reader: "json", Writer: "json", Extension: "json"},
+	{Name: "csv", Reader: "csv", Extension: "csv"},
+	{Name: "tsv", Reader: "tsv", Extension: "tsv"},
+	{Name: "bibtex", Reader: "bibtex", Writer: "bibtex", Extension: "bib"},
+	{Name: "biblatex", Reader: "biblatex", Writer: "biblatex", Extension: "bib"},
+	{Name: "csljson", Reader: "csljson", Writer: "csljson", Extension: "json"},
+}
+
+// formatAliases maps alternative user-facing names to canonical format names
+var formatAliases = map[string]string{
+	"txt":             "plain",
+	"text":            "plain",
+	"md":              "markdown",
+	"htm":             "html",
+	"tex":             "latex",
+	"adoc":            "asciidoc",
+	"typ":             "typst",
+	"wiki":            "mediawiki",
+	"markdown_github": "gfm",
+}
+
+// extensionFormats maps file extensions (without the dot) to canonical format names
+var extensionFormats = map[string]string{
+	"md":       "markdown",
+	"markdown": "markdown",
+	"mkd":      "markdown",
+	"html":     "html",
+	"htm":      "html",
+	"xhtml":    "html",
+	"txt":      "plain",
+	"text":     "plain",
+	"tex":      "latex",
+	"latex":    "latex",
+	"ltx":      "latex",
+	"rst":      "rst",
+	"pdf":      "pdf",
+	"docx":     "docx",
+	"odt":      "odt",
+	"pptx":     "pptx",
+	"epub":     "epub",
+	"adoc":     "asciidoc",
+	"asciidoc": "asciidoc",
+	"typ":      "typst",
+	"org":      "org",
+	"ipynb":    "ipynb",
+	"textile":  "textile",
+	"wiki":     "mediawiki",
+	"xml":      "docbook",
+	"dbk":      "docbook",
+	"texi":     "texinfo",
+	"rtf":      "rtf",
+	"fb2":      "fb2",
+	"opml":     "opml",
+	"json":     "json",
+	"csv":      "csv",
+	"tsv":      "tsv",
+	"bib":      "bibtex",
+}
+
+// mimeTypes maps canonical format names to the media type of their output
+var mimeTypes = map[string]string{
+	"markdown":    "text/markdown",
+	"gfm":         "text/markdown",
+	"commonmark":  "text/markdown",
+	"html":        "text/html",
+	"html4":       "text/html",
+	"html5":       "text/html",
+	"revealjs":    "text/html",
+	"chunkedhtml": "application/zip",
+	"plain":       "text/plain",
+	"pdf":         "application/pdf",
+	"docx":        "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"odt":         "application/vnd.oasis.opendocument.text",
+	"pptx":        "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"epub":        "application/epub+zip",
+	"epub2":       "application/epub+zip",
+	"epub3":       "application/epub+zip",
+	"latex":       "application/x-latex",
+	"beamer":      "application/x-latex",
+	"rst":         "text/x-rst",
+	"asciidoc":    "text/asciidoc",
+	"org":         "text/org",
+	"ipynb":       "application/x-ipynb+json",
+	"docbook":     "application/docbook+xml",
+	"jats":        "application/xml",
+	"tei":         "application/tei+xml",
+	"rtf":         "application/rtf",
+	"fb2":         "application/x-fictionbook+xml",
+	"json":        "application/json",
+	"csljson":     "application/vnd.citationstyles.csl+json",
+	"bibtex":      "application/x-bibtex",
+	"biblatex":    "application/x-bibtex",
+}
+
+// formatsByName indexes knownFormats by name
+var formatsByName = func() map[string]FormatInfo {
+	m := make(map[string]FormatInfo, len(knownFormats))
+	for _, f := range knownFormats {
+		m[f.Name] = f
+	}
+	return m
+}()
+
+// LookupFormat resolves a user-facing format name or alias, ignoring any
+// +ext/-ext modifiers. Formats missing from the registry are passed to pandoc
+// unchanged as both reader and writer.
+func LookupFormat(format string) FormatInfo {
+	base, _ := SplitFormat(strings.ToLower(strings.TrimSpace(format)))
+	if canonical, ok := formatAliases[base]; ok {
+		base = canonical
+	}
+	if info, ok := formatsByName[base]; ok {
+		return info
+	}
+	return FormatInfo{Name: base, Reader: base, Writer: base, Extension: base}
+}
+
+// ResolveReader returns the pandoc reader for format with its modifiers
+// preserved, e.g. "md+smart" becomes "markdown+smart"
+func ResolveReader(format string) string {
+	return LookupFormat(format).Reader + formatModifiers(format)
+}
+
+// ResolveWriter returns the pandoc writer for format with its modifiers
+// preserved, e.g. "txt" becomes "plain"
+func ResolveWriter(format string) string {
+	return LookupFormat(format).Writer + formatModifiers(format)
+}
+
+// NeedsOutputFile checks if output in the format must be written to a file
+func NeedsOutputFile(format string) bool {
+	return LookupFormat(format).NeedsOutputFile
+}
+
+// IsBinaryFormat checks if output in the format is binary
+func IsBinaryFormat(format string) bool {
+	return LookupFormat(format).Binary
+}
+
+// fileOnlyWriters cannot write to stdout, even with -o -
+var fileOnlyWriters = map[string]bool{
+	"chunkedhtml": true,
+}
+
+// readsStdin checks if pandoc can read input in the format from stdin.
+// ZIP-based formats such as docx and epub are read from a file.
+func readsStdin(format string) bool {
+	return !LookupFormat(format).Binary
+}
+
+// writesStdout checks if pandoc can write output in the format to stdout
+func writesStdout(format string) bool {
+	return !fileOnlyWriters[LookupFormat(format).Writer]
+}
+
+// FileExtension returns the default file extension for format, including the dot
+func FileExtension(format string) string {
+	return "." + LookupFormat(format).Extension
+}
+
+// MIMEType returns the media type of output in format
+func MIMEType(format string) string {
+	info := LookupFormat(format)
+	if mimeType, ok := mimeTypes[info.Name]; ok {
+		return mimeType
+	}
+	if mimeType := mime.TypeByExtension("." + info.Extension); mimeType != "" {
+		return mimeType
+	}
+	if info.Binary {
+		return "application/octet-stream"
+	}
+	return "text/plain"
+}
+
+// FormatForMIMEType returns the canonical format whose output has the given
+// media type. Parameters such as charset are ignored.
+func FormatForMIMEType(mimeType string) (string, bool) {
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mimeType = mediaType
+	}
+	// knownFormats order prefers the common name, e.g. markdown over gfm
+	for _, f := range knownFormats {
+		if mimeTypes[f.Name] == mimeType {
+			return f.Name, true
+		}
+	}
+	return "", false
+}
+
+// FormatForFile returns the canonical format for a file path based on its extension
+func FormatForFile(path string) (string, bool) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	format, ok := extensionFormats[ext]
+	return format, ok
+}
+
+// formatModifiers returns the +ext/-ext suffix of a format
+func formatModifiers(format string) string {
+	format = strings.TrimSpace(format)
+	if i := strings.IndexAny(format, "+-"); i >= 0 {
+		return format[i:]
+	}
+	return ""
+}
+
+// InputNames returns the discovered input formats together with the
+// registry names and aliases that resolve to one of them
+func (c *Capabilities) InputNames() []string {
+	return c.namesWith(c.inputSet, func(f FormatInfo) string { return f.Reader })
+}
+
+// OutputNames returns the discovered output formats together with the
+// registry names and aliases that resolve to one of them
+func (c *Capabilities) OutputNames() []string {
+	return c.namesWith(c.outputSet, func(f FormatInfo) string { return f.Writer })
+}
+
+// namesWith collects names whose pandoc counterpart is in formats
+func (c *Capabilities) namesWith(formats map[string]bool, pandocName func(FormatInfo) string) []string {
+	names := make(map[string]bool, len(formats))
+	for name := range formats {
+		names[name] = true
+	}
+	for _, f := range knownFormats {
+		if formats[pandocName(f)] {
+			names[f.Name] = true
+		}
+	}
+	for alias := range formatAliases {
+		if formats[pandocName(LookupFormat(alias))] {
+			names[alias] = true
+		}
+	}
+
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,91 @@
+package pandoc
+
+import (
+	_ "embed"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// resourceGuardFilter removes images and raw TeX that would read files
+// outside the resource path, and loads the remaining images under --sandbox
+//
+//go:embed lua/resource-guard.lua
+var resourceGuardFilter []byte
+
+// ErrRemoteResourcesDisabled is returned when a request asks for remote
+// resources the server does not allow
+var ErrRemoteResourcesDisabled = &OptionError{
+	Option: "allow_remote_resources",
+	Reason: "remote resources are disabled by the server configuration",
+}
+
+// ResourcePolicy controls which files and URLs pandoc may read while
+// converting, beyond the files given on its command line
+type ResourcePolicy struct {
+	// Sandbox runs pandoc with --sandbox, so documents cannot pull in local
+	// files or URLs through images and other references
+	Sandbox bool
+	// AllowRemote lets requests enable fetching of remote images
+	AllowRemote bool
+}
+
+// ResourcePolicyFromEnv reads the policy from PANDOC_SANDBOX (on by default)
+// and PANDOC_ALLOW_REMOTE_RESOURCES (off by default)
+func ResourcePolicyFromEnv() ResourcePolicy {
+	return ResourcePolicy{
+		Sandbox:     envBool("PANDOC_SANDBOX", true),
+		AllowRemote: envBool("PANDOC_ALLOW_REMOTE_RESOURCES", false),
+	}
+}
+
+// resourceArgs returns the arguments restricting what pandoc may read. A
+// request allowed to fetch remote resources cannot run in --sandbox, which
+// blocks the network too. The resource guard filter runs either way: it
+// removes raw TeX, which --sandbox does not cover as PDF production is
+// exempt from it, keeps local images inside the resource path and, under
+// --sandbox, loads them from there, as pandoc itself then ignores
+// --resource-path.
+func (p *PandocConverter) resourceArgs(opts Options, workDir string) ([]string, error) {
+	if opts.AllowRemoteResources && !p.resources.AllowRemote {
+		return nil, ErrRemoteResourcesDisabled
+	}
+
+	sandbox := p.resources.Sandbox && !opts.AllowRemoteResources
+	// pandoc before 2.15 has no --sandbox and relies on the guard filter alone
+	if probe, err := p.current(); err == nil && !probe.Features.Sandbox {
+		sandbox = false
+	}
+
+	filterPath, err := writeWorkFile(workDir, "resource-guard-*.lua", resourceGuardFilter)
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	if sandbox {
+		args = append(args, "--sandbox")
+	}
+	args = append(args,
+		"--metadata", "resource-guard-remote="+strconv.FormatBool(opts.AllowRemoteResources),
+		"--metadata", "resource-guard-embed="+strconv.FormatBool(sandbox),
+		"--lua-filter", filterPath,
+	)
+
+	if len(opts.ResourcePath) > 0 {
+		args = append(args, "--resource-path="+strings.Join(opts.ResourcePath, string(filepath.ListSeparator)))
+	}
+
+	return args, nil
+}
+
+// envBool reads an on/off environment variable
+func envBool(name string, fallback bool) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(name))) {
+	case "1", "true", "on", "yes":
+		return true
+	case "0", "false", "off", "no":
+		return false
+	}
+	return fallback
+}
@@ -0,0 +1,153 @@
+package pandoc
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// secretMarker is the content of a file documents must not be able to embed
+const secretMarker = "TOPSECRET-RESOURCE-GUARD"
+
+// newTestConverter creates a converter for the installed pandoc with
+// caching off and the given environment
+func newTestConverter(t *testing.T, env map[string]string) *PandocConverter {
+	t.Helper()
+	requirePandoc(t)
+	t.Setenv("PANDOC_CACHE", "off")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	converter, err := NewConverter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return converter
+}
+
+// writePNG writes a 1x1 PNG image to path
+func writePNG(t *testing.T, path string) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// zipEntries returns the contents of the entries of a zip archive by name
+func zipEntries(t *testing.T, path string) map[string][]byte {
+	t.Helper()
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	entries := make(map[string][]byte)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[f.Name] = data
+	}
+	return entries
+}
+
+// leakyDocument writes a document in a docs directory that references a
+// secret outside it in every way the resource guard covers, next to one
+// legitimate image, and returns its path
+func leakyDocument(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	secretDir := filepath.Join(dir, "secret")
+	docsDir := filepath.Join(dir, "docs")
+	for _, d := range []string{secretDir, docsDir} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	secret := filepath.Join(secretDir, "secret.png")
+	if err := os.WriteFile(secret, []byte(secretMarker), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writePNG(t, filepath.Join(docsDir, "pic.png"))
+
+	doc := strings.Join([]string{
+		"![passwd](/etc/passwd)",
+		"![absolute](" + filepath.ToSlash(secret) + ")",
+		"![parent](../secret/secret.png)",
+		"![file](file://" + filepath.ToSlash(secret) + ")",
+		`\input{` + filepath.ToSlash(secret) + `}`,
+		"```{=latex}\n\\includegraphics{" + filepath.ToSlash(secret) + "}\n```",
+		"![pic](pic.png)",
+	}, "\n\n")
+	docPath := filepath.Join(docsDir, "doc.md")
+	if err := os.WriteFile(docPath, []byte(doc+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return docPath
+}
+
+func TestResourceGuard(t *testing.T) {
+	for _, sandbox := range []string{"on", "off"} {
+		t.Run("sandbox "+sandbox+" docx", func(t *testing.T) {
+			converter := newTestConverter(t, map[string]string{"PANDOC_SANDBOX": sandbox})
+			docPath := leakyDocument(t)
+			outputFile := filepath.Join(t.TempDir(), "out.docx")
+
+			opts := Options{ResourcePath: []string{filepath.Dir(docPath)}}
+			if _, err := converter.ConvertFile(context.Background(), docPath, "markdown", "docx", outputFile, opts); err != nil {
+				t.Fatal(err)
+			}
+
+			media := 0
+			for name, data := range zipEntries(t, outputFile) {
+				if bytes.Contains(data, []byte(secretMarker)) || bytes.Contains(data, []byte("root:")) {
+					t.Errorf("%s embeds a file outside the resource path", name)
+				}
+				if strings.HasPrefix(name, "word/media/") {
+					media++
+				}
+			}
+			if media != 1 {
+				t.Errorf("docx has %d media files, want only pic.png", media)
+			}
+		})
+
+		t.Run("sandbox "+sandbox+" latex", func(t *testing.T) {
+			converter := newTestConverter(t, map[string]string{"PANDOC_SANDBOX": sandbox})
+			docPath := leakyDocument(t)
+
+			opts := Options{ResourcePath: []string{filepath.Dir(docPath)}}
+			result, err := converter.ConvertFile(context.Background(), docPath, "markdown", "latex", "", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output := string(result.Output)
+			for _, leak := range []string{`\input`, "secret.png", "/etc/passwd"} {
+				if strings.Contains(output, leak) {
+					t.Errorf("latex output contains %q:\n%s", leak, output)
+				}
+			}
+			if !strings.Contains(output, "pic.png") {
+				t.Errorf("latex output lost the image in the resource path:\n%s", output)
+			}
+		})
+	}
+}
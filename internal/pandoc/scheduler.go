@@ -0,0 +1,234 @@
+package pandoc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// Scheduler lanes
+const (
+	// LaneDefault runs conversions to light formats such as html or docx
+	LaneDefault = "default"
+	// LaneHeavy runs conversions to formats that start a LaTeX engine or
+	// build large archives, such as pdf and epub
+	LaneHeavy = "heavy"
+)
+
+// DefaultMaxQueue is the number of conversions that may wait in each lane
+const DefaultMaxQueue = 32
+
+// heavyFormats are the output formats run in the heavy lane
+var heavyFormats = map[string]bool{
+	"pdf": true, "epub": true, "epub2": true, "epub3": true,
+}
+
+// BusyError is returned when a lane's queue is full
+type BusyError struct {
+	Lane   string `json:"lane"`
+	Queued int    `json:"queued"`
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("server busy: %d conversions already waiting in the %s lane", e.Queued, e.Lane)
+}
+
+func (e *BusyError) Kind() string { return ErrorServerBusy }
+
+func (e *BusyError) Hint() string {
+	return "Retry after the running conversions finish, or send fewer conversions at once."
+}
+
+// Scheduler bounds the number of pandoc processes running at once. Heavy
+// formats have a separate, smaller lane so they cannot take every slot.
+// Conversions beyond the limit wait in a bounded queue, served round-robin
+// between clients so one client's burst does not starve the others.
+type Scheduler struct {
+	mu    sync.Mutex
+	lanes map[string]*lane
+}
+
+// lane is one pool of slots with its queue of waiting conversions
+type lane struct {
+	name     string
+	slots    int
+	maxQueue int
+	running  int
+	queued   int
+	// waiting holds each client's conversions in arrival order; clients
+	// lists the clients with waiting conversions in round-robin order
+	waiting map[string][]*waiter
+	clients []string
+}
+
+// waiter is a conversion waiting for a slot
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// NewScheduler creates a scheduler running at most maxParallel light and
+// maxHeavy heavy conversions at once, with up to maxQueue waiting in each lane
+func NewScheduler(maxParallel, maxHeavy, maxQueue int) *Scheduler {
+	return &Scheduler{lanes: map[string]*lane{
+		LaneDefault: newLane(LaneDefault, maxParallel, maxQueue),
+		LaneHeavy:   newLane(LaneHeavy, maxHeavy, maxQueue),
+	}}
+}
+
+// SchedulerFromEnv creates a scheduler from PANDOC_MAX_PARALLEL (default:
+// number of CPUs), PANDOC_MAX_HEAVY_PARALLEL (default: a quarter of that, at
+// least 1) and PANDOC_MAX_QUEUE (default 32)
+func SchedulerFromEnv() *Scheduler {
+	maxParallel := envInt("PANDOC_MAX_PARALLEL", runtime.NumCPU())
+	maxHeavy := envInt("PANDOC_MAX_HEAVY_PARALLEL", max(1, maxParallel/4))
+	maxQueue := envInt("PANDOC_MAX_QUEUE", DefaultMaxQueue)
+	return NewScheduler(maxParallel, maxHeavy, maxQueue)
+}
+
+func newLane(name string, slots, maxQueue int) *lane {
+	return &lane{
+		name:     name,
+		slots:    max(1, slots),
+		maxQueue: max(0, maxQueue),
+		waiting:  make(map[string][]*waiter),
+	}
+}
+
+// LaneFor returns the lane conversions to outputFormat run in
+func LaneFor(outputFormat string) string {
+	if heavyFormats[LookupFormat(outputFormat).Name] {
+		return LaneHeavy
+	}
+	return LaneDefault
+}
+
+// Acquire waits for a slot in the lane of outputFormat and returns the
+// function releasing it. It fails with a BusyError when the queue is full and
+// with ctx's error when ctx ends first. The client comes from WithClient.
+func (s *Scheduler) Acquire(ctx context.Context, outputFormat string) (func(), error) {
+	client := clientFromContext(ctx)
+
+	s.mu.Lock()
+	l := s.lanes[LaneFor(outputFormat)]
+	if l.running < l.slots && l.queued == 0 {
+		l.running++
+		s.mu.Unlock()
+		return s.releaser(l), nil
+	}
+	if l.queued >= l.maxQueue {
+		queued := l.queued
+		s.mu.Unlock()
+		return nil, &BusyError{Lane: l.name, Queued: queued}
+	}
+
+	w := &waiter{ready: make(chan struct{})}
+	if len(l.waiting[client]) == 0 {
+		l.clients = append(l.clients, client)
+	}
+	l.waiting[client] = append(l.waiting[client], w)
+	l.queued++
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return s.releaser(l), nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		if w.granted {
+			// The slot arrived together with the cancellation: pass it on
+			l.running--
+			s.dispatch(l)
+		} else {
+			l.remove(client, w)
+		}
+		s.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// releaser returns a function freeing one slot of l, safe to call twice
+func (s *Scheduler) releaser(l *lane) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			l.running--
+			s.dispatch(l)
+			s.mu.Unlock()
+		})
+	}
+}
+
+// dispatch hands free slots to waiting conversions, taking the oldest of
+// each client in turn. Called with s.mu held.
+func (s *Scheduler) dispatch(l *lane) {
+	for l.running < l.slots && len(l.clients) > 0 {
+		client := l.clients[0]
+		queue := l.waiting[client]
+		w := queue[0]
+		if len(queue) == 1 {
+			delete(l.waiting, client)
+			l.clients = l.clients[1:]
+		} else {
+			l.waiting[client] = queue[1:]
+			// The client goes to the back of the rotation
+			l.clients = append(l.clients[1:], client)
+		}
+
+		l.queued--
+		l.running++
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+// remove takes a waiter that gave up out of the queue. Called with s.mu held.
+func (l *lane) remove(client string, w *waiter) {
+	queue := l.waiting[client]
+	for i, queuedWaiter := range queue {
+		if queuedWaiter != w {
+			continue
+		}
+		queue = append(queue[:i], queue[i+1:]...)
+		l.queued--
+		break
+	}
+	if len(queue) > 0 {
+		l.waiting[client] = queue
+		return
+	}
+	delete(l.waiting, client)
+	for i, c := range l.clients {
+		if c == client {
+			l.clients = append(l.clients[:i], l.clients[i+1:]...)
+			break
+		}
+	}
+}
+
+// clientKey is the context key of the client identity used for fairness
+type clientKey struct{}
+
+// WithClient returns a context identifying the client a conversion is run
+// for, e.g. its MCP session
+func WithClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// clientFromContext returns the client set by WithClient, "" if none
+func clientFromContext(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey{}).(string)
+	return client
+}
+
+// envInt reads a positive integer environment variable
+func envInt(name string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
@@ -0,0 +1,155 @@
+package pandoc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitQueued waits until n conversions wait in the lane
+func waitQueued(t *testing.T, s *Scheduler, lane string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		queued := s.lanes[lane].queued
+		s.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d conversions queued in the %s lane, want %d", queued, lane, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// acquire takes a slot for html output, failing the test if there is none
+func acquire(t *testing.T, s *Scheduler, ctx context.Context) func() {
+	t.Helper()
+	release, err := s.Acquire(ctx, "html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return release
+}
+
+func TestSchedulerQueueLimit(t *testing.T) {
+	s := NewScheduler(1, 1, 1)
+	release := acquire(t, s, context.Background())
+
+	done := make(chan error)
+	go func() {
+		release, err := s.Acquire(context.Background(), "html")
+		if err == nil {
+			release()
+		}
+		done <- err
+	}()
+	waitQueued(t, s, LaneDefault, 1)
+
+	_, err := s.Acquire(context.Background(), "html")
+	var busy *BusyError
+	if !errors.As(err, &busy) {
+		t.Fatalf("Acquire() = %v, want a BusyError", err)
+	}
+	if busy.Lane != LaneDefault || busy.Queued != 1 {
+		t.Errorf("BusyError = %+v, want 1 queued in the default lane", busy)
+	}
+
+	// The heavy lane has a queue of its own
+	heavyRelease, err := s.Acquire(context.Background(), "pdf")
+	if err != nil {
+		t.Fatalf("heavy Acquire() = %v, want a slot", err)
+	}
+	heavyRelease()
+
+	release()
+	if err := <-done; err != nil {
+		t.Errorf("queued conversion failed: %v", err)
+	}
+}
+
+func TestSchedulerRoundRobin(t *testing.T) {
+	s := NewScheduler(1, 1, 10)
+	release := acquire(t, s, context.Background())
+
+	// Client a queues three conversions before client b queues two
+	type grant struct {
+		name    string
+		release func()
+	}
+	granted := make(chan grant)
+	queued := 0
+	for _, c := range []struct{ client, name string }{
+		{"a", "a1"}, {"a", "a2"}, {"a", "a3"}, {"b", "b1"}, {"b", "b2"},
+	} {
+		ctx := WithClient(context.Background(), c.client)
+		go func(name string) {
+			release, err := s.Acquire(ctx, "html")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			granted <- grant{name, release}
+		}(c.name)
+		queued++
+		waitQueued(t, s, LaneDefault, queued)
+	}
+
+	var order []string
+	release()
+	for range queued {
+		g := <-granted
+		order = append(order, g.name)
+		g.release()
+	}
+
+	want := []string{"a1", "b1", "a2", "b2", "a3"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("grant order = %v, want %v", order, want)
+		}
+	}
+}
+
+func TestSchedulerCancelAfterGrant(t *testing.T) {
+	s := NewScheduler(1, 1, 1)
+	acquire(t, s, context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		release, err := s.Acquire(ctx, "html")
+		if err == nil {
+			release()
+		}
+		done <- err
+	}()
+	waitQueued(t, s, LaneDefault, 1)
+
+	// Cancel, let the waiter see it and block on the lock, then free the
+	// held slot, which dispatch grants to the cancelled waiter
+	s.mu.Lock()
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	l := s.lanes[LaneDefault]
+	l.running--
+	s.dispatch(l)
+	s.mu.Unlock()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Acquire() = %v, want context.Canceled", err)
+	}
+	s.mu.Lock()
+	running, queued := l.running, l.queued
+	s.mu.Unlock()
+	if running != 0 || queued != 0 {
+		t.Fatalf("lane has %d running and %d queued, want the granted slot released", running, queued)
+	}
+
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), time.Second)
+	defer cancelTimeout()
+	acquire(t, s, timeout)()
+}
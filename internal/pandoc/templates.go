@@ -0,0 +1,147 @@
+package pandoc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds of files in the template registry
+const (
+	TemplateKindTemplate     = "template"
+	TemplateKindReferenceDoc = "reference-doc"
+	TemplateKindCSS          = "css"
+)
+
+// defaultTemplatesDir is the registry directory used when PANDOC_TEMPLATES_DIR is unset
+const defaultTemplatesDir = "templates"
+
+// Output formats served by files with these extensions, beyond the writer
+// whose name matches the extension
+var (
+	htmlFormats  = []string{"html", "html4", "html5"}
+	latexFormats = []string{"latex", "pdf", "beamer"}
+	cssFormats   = []string{"html", "html4", "html5", "epub", "epub2", "epub3"}
+)
+
+// TemplateFile is one file of a named template
+type TemplateFile struct {
+	Path    string   `json:"file"`
+	Kind    string   `json:"kind"`
+	Formats []string `json:"formats"`
+}
+
+// Template is a named set of pandoc templates, reference documents and
+// stylesheets, e.g. corporate.docx, corporate.html and corporate.css
+type Template struct {
+	Name  string         `json:"name"`
+	Files []TemplateFile `json:"files"`
+}
+
+// TemplateRegistry finds named templates in a directory
+type TemplateRegistry struct {
+	namedFiles
+}
+
+// NewTemplateRegistry creates a registry for the given directory
+func NewTemplateRegistry(dir string) *TemplateRegistry {
+	return &TemplateRegistry{newNamedFiles(dir, registryNamePattern)}
+}
+
+// TemplateRegistryFromEnv creates a registry for PANDOC_TEMPLATES_DIR, or the
+// templates directory next to the executable by default
+func TemplateRegistryFromEnv() *TemplateRegistry {
+	return &TemplateRegistry{namedFilesFromEnv("PANDOC_TEMPLATES_DIR", defaultTemplatesDir, registryNamePattern)}
+}
+
+// List scans the registry directory and returns the templates sorted by name.
+// A missing directory yields an empty list.
+func (r *TemplateRegistry) List() ([]Template, error) {
+	files, err := r.list()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*Template)
+	for _, file := range files {
+		kind, formats := classifyTemplateFile(strings.ToLower(strings.TrimPrefix(file.Ext, ".")))
+		if kind == "" {
+			continue
+		}
+
+		t, ok := byName[file.Name]
+		if !ok {
+			t = &Template{Name: file.Name}
+			byName[file.Name] = t
+		}
+		t.Files = append(t.Files, TemplateFile{
+			Path:    file.Path,
+			Kind:    kind,
+			Formats: formats,
+		})
+	}
+
+	templates := make([]Template, 0, len(byName))
+	for _, t := range byName {
+		templates = append(templates, *t)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// Resolve returns the pandoc arguments applying the named template to the
+// output format: --reference-doc for docx/odt/pptx, --template and --css otherwise
+func (r *TemplateRegistry) Resolve(name, outputFormat string) ([]string, error) {
+	if !r.validName(name) {
+		return nil, &OptionError{Option: "template", Reason: "invalid template name: " + name}
+	}
+
+	templates, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+
+	format := LookupFormat(outputFormat).Name
+	for _, t := range templates {
+		if t.Name != name {
+			continue
+		}
+
+		var args []string
+		seen := make(map[string]bool)
+		for _, file := range t.Files {
+			if seen[file.Kind] || !contains(file.Formats, format) {
+				continue
+			}
+			seen[file.Kind] = true
+			args = append(args, "--"+file.Kind+"="+file.Path)
+		}
+		if len(args) == 0 {
+			return nil, &OptionError{Option: "template", Reason: fmt.Sprintf("template %s has no file for %s output", name, outputFormat)}
+		}
+		return args, nil
+	}
+
+	return nil, &OptionError{Option: "template", Reason: "template not found: " + name}
+}
+
+// classifyTemplateFile returns the kind of a registry file and the output
+// formats it applies to, based on its extension
+func classifyTemplateFile(ext string) (string, []string) {
+	switch ext {
+	case "docx", "odt", "pptx":
+		return TemplateKindReferenceDoc, []string{ext}
+	case "css":
+		return TemplateKindCSS, cssFormats
+	case "html":
+		return TemplateKindTemplate, htmlFormats
+	case "latex", "tex":
+		return TemplateKindTemplate, latexFormats
+	}
+
+	// Other templates are named after their pandoc writer, e.g. report.typst
+	if info, ok := formatsByName[ext]; ok && info.Writer == ext && !info.Binary {
+		return TemplateKindTemplate, []string{ext}
+	}
+	return "", nil
+}
@@ -0,0 +1,115 @@
+package pandoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is used for output formats without a specific timeout
+const DefaultTimeout = 60 * time.Second
+
+// processWaitDelay is how long to wait for output pipes to close after
+// pandoc has been killed
+const processWaitDelay = 5 * time.Second
+
+// defaultFormatTimeouts holds timeouts for formats that are slow to build
+var defaultFormatTimeouts = map[string]time.Duration{
+	"pdf":  5 * time.Minute,
+	"docx": 2 * time.Minute,
+	"epub": 2 * time.Minute,
+	"html": 30 * time.Second,
+}
+
+// Timeouts holds the maximum duration of a single pandoc run per output format
+type Timeouts struct {
+	Default   time.Duration
+	PerFormat map[string]time.Duration
+}
+
+// TimeoutsFromEnv builds timeouts from the built-in defaults, overridden by
+// PANDOC_TIMEOUT (all formats) and PANDOC_TIMEOUT_<FORMAT> (e.g. PANDOC_TIMEOUT_PDF).
+// Values use Go duration syntax ("90s", "10m") or plain seconds ("90").
+func TimeoutsFromEnv() Timeouts {
+	t := Timeouts{
+		Default:   DefaultTimeout,
+		PerFormat: make(map[string]time.Duration),
+	}
+	for format, d := range defaultFormatTimeouts {
+		t.PerFormat[format] = d
+	}
+
+	if d, ok := parseTimeout(os.Getenv("PANDOC_TIMEOUT")); ok {
+		t.Default = d
+		// A global override applies to every format unless set explicitly below
+		for format := range t.PerFormat {
+			t.PerFormat[format] = d
+		}
+	}
+
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(name, "PANDOC_TIMEOUT_") {
+			continue
+		}
+		format := strings.ToLower(strings.TrimPrefix(name, "PANDOC_TIMEOUT_"))
+		if d, ok := parseTimeout(value); ok && format != "" {
+			t.PerFormat[format] = d
+		}
+	}
+
+	return t
+}
+
+// For returns the timeout for the given output format
+func (t Timeouts) For(format string) time.Duration {
+	if d, ok := t.PerFormat[format]; ok {
+		return d
+	}
+	if t.Default > 0 {
+		return t.Default
+	}
+	return DefaultTimeout
+}
+
+// parseTimeout parses a duration or a number of seconds
+func parseTimeout(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d, true
+	}
+	var seconds int
+	if _, err := fmt.Sscanf(value, "%d", &seconds); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	return 0, false
+}
+
+// TimeoutError is returned when pandoc does not finish within its timeout
+type TimeoutError struct {
+	Format  string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("pandoc conversion to %s timed out after %s", e.Format, e.Timeout)
+}
+
+func (e *TimeoutError) Kind() string { return ErrorTimeout }
+
+func (e *TimeoutError) Hint() string {
+	return "Split the document, simplify it, or ask the server operator to raise PANDOC_TIMEOUT for this format."
+}
+
+// MarshalJSON reports the timeout in a readable form such as "5m0s"
+func (e *TimeoutError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"output_format": e.Format,
+		"timeout":       e.Timeout.String(),
+	})
+}
@@ -0,0 +1,210 @@
+package pandoc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Types of warnings reported by pandoc
+const (
+	WarningCitationNotFound    = "citation_not_found"
+	WarningResourceNotFound    = "resource_not_found"
+	WarningImage               = "image_problem"
+	WarningContentDropped      = "content_dropped"
+	WarningReferenceNotFound   = "reference_not_found"
+	WarningDuplicateIdentifier = "duplicate_identifier"
+	WarningMissingCharacter    = "missing_character"
+	WarningOther               = "warning"
+)
+
+// pandocWarningTypes maps pandoc log message types to warning types
+var pandocWarningTypes = map[string]string{
+	"CouldNotFetchResource":      WarningResourceNotFound,
+	"CouldNotDetermineImageSize": WarningImage,
+	"CouldNotConvertImage":       WarningImage,
+	"CouldNotDetermineMimeType":  WarningImage,
+	"SkippedContent":             WarningContentDropped,
+	"IgnoredElement":             WarningContentDropped,
+	"InlineNotRendered":          WarningContentDropped,
+	"BlockNotRendered":           WarningContentDropped,
+	"ReferenceNotFound":          WarningReferenceNotFound,
+	"DuplicateIdentifier":        WarningDuplicateIdentifier,
+	"MissingCharacter":           WarningMissingCharacter,
+}
+
+// Warning is a problem pandoc reported without failing the conversion
+type Warning struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	// PandocType is pandoc's name for the log message, e.g. CouldNotFetchResource
+	PandocType string `json:"pandoc_type,omitempty"`
+	// Key is the citation key for citation warnings
+	Key string `json:"key,omitempty"`
+	// Path is the image or resource a warning is about
+	Path string `json:"path,omitempty"`
+	// Line and Column locate the warning in the input, when pandoc knows it
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+var (
+	warningPrefix           = regexp.MustCompile(`^\[WARNING\]\s*`)
+	citationNotFoundPattern = regexp.MustCompile(`[Cc]itation (\S+) not found`)
+	fetchResourcePattern    = regexp.MustCompile(`^Could not fetch resource (\S+?):?(?:\s|$)`)
+)
+
+// logEntry is one message of pandoc's JSON log, written by --log
+type logEntry struct {
+	Type      string          `json:"type"`
+	Verbosity string          `json:"verbosity"`
+	Message   string          `json:"message"`
+	Path      string          `json:"path"`
+	Contents  json.RawMessage `json:"contents"`
+	Line      int             `json:"line"`
+	Column    int             `json:"column"`
+}
+
+// readWarnings returns the warnings pandoc wrote to its JSON log at logFile.
+// pandoc versions without a usable log fall back to the [WARNING] lines of
+// stderr.
+func readWarnings(logFile string, stderr []byte) []Warning {
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		return parseWarnings(stderr)
+	}
+	warnings, err := parseLog(data)
+	if err != nil {
+		return parseWarnings(stderr)
+	}
+	return warnings
+}
+
+// parseLog extracts the warnings from pandoc's JSON log. Informational
+// messages, such as fetched resources or filters run, are skipped.
+func parseLog(data []byte) ([]Warning, error) {
+	var entries []logEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	var warnings []Warning
+	for _, entry := range entries {
+		if entry.Verbosity != "WARNING" && entry.Verbosity != "ERROR" {
+			continue
+		}
+		w := newWarning(entry.text())
+		if kind, ok := pandocWarningTypes[entry.Type]; ok {
+			w.Type = kind
+		}
+		w.PandocType = entry.Type
+		if entry.Path != "" {
+			w.Path = entry.Path
+		}
+		w.Line = entry.Line
+		w.Column = entry.Column
+		warnings = append(warnings, w)
+	}
+	return warnings, nil
+}
+
+// text renders a log entry the way pandoc prints it on stderr
+func (e logEntry) text() string {
+	contents := e.contents()
+	var msg string
+	switch e.Type {
+	case "CiteprocWarning":
+		msg = "Citeproc: " + e.Message
+	case "CouldNotFetchResource":
+		msg = "Could not fetch resource " + e.Path
+	case "CouldNotDetermineImageSize":
+		msg = "Could not determine image size for " + e.Path
+	case "CouldNotConvertImage":
+		msg = "Could not convert image " + e.Path
+	case "CouldNotDetermineMimeType":
+		msg = "Could not determine mime type for " + e.Path
+	case "SkippedContent":
+		msg = fmt.Sprintf("Skipped '%s'", contents)
+	case "IgnoredElement":
+		msg = fmt.Sprintf("Ignored element %s", contents)
+	case "InlineNotRendered", "BlockNotRendered":
+		msg = "Not rendering " + contents
+	case "ReferenceNotFound":
+		msg = fmt.Sprintf("Reference not found for '%s'", contents)
+	case "DuplicateIdentifier":
+		msg = fmt.Sprintf("Duplicate identifier '%s'", contents)
+	case "MissingCharacter":
+		msg = "Missing character: " + e.Message
+	default:
+		msg = e.Type
+		if contents != "" {
+			msg += " " + contents
+		}
+	}
+
+	if e.Message != "" && !strings.Contains(msg, e.Message) {
+		msg += ": " + e.Message
+	}
+	if e.Line > 0 {
+		msg += fmt.Sprintf(" at line %d, column %d", e.Line, e.Column)
+	}
+	return msg
+}
+
+// contents returns the contents field as text. Elements that were not
+// rendered are logged as pandoc AST objects, kept as compact JSON.
+func (e logEntry) contents() string {
+	if len(e.Contents) == 0 {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(e.Contents, &s); err == nil {
+		return s
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, e.Contents); err != nil {
+		return string(e.Contents)
+	}
+	return buf.String()
+}
+
+// parseWarnings extracts the [WARNING] messages from pandoc's stderr.
+// Continuation lines indented under a warning are joined to it.
+func parseWarnings(stderr []byte) []Warning {
+	var warnings []Warning
+
+	scanner := bufio.NewScanner(bytes.NewReader(stderr))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if loc := warningPrefix.FindStringIndex(line); loc != nil {
+			warnings = append(warnings, newWarning(line[loc[1]:]))
+			continue
+		}
+		if len(warnings) > 0 && strings.HasPrefix(line, " ") && strings.TrimSpace(line) != "" {
+			last := &warnings[len(warnings)-1]
+			*last = newWarning(last.Message + " " + strings.TrimSpace(line))
+		}
+	}
+
+	return warnings
+}
+
+// newWarning classifies a warning message
+func newWarning(message string) Warning {
+	message = strings.TrimSpace(message)
+	if m := citationNotFoundPattern.FindStringSubmatch(message); m != nil {
+		return Warning{Type: WarningCitationNotFound, Message: message, Key: m[1]}
+	}
+	if m := fetchResourcePattern.FindStringSubmatch(message); m != nil {
+		return Warning{Type: WarningResourceNotFound, Message: message, Path: m[1]}
+	}
+	if strings.HasPrefix(message, "Not rendering ") {
+		return Warning{Type: WarningContentDropped, Message: message}
+	}
+	return Warning{Type: WarningOther, Message: message}
+}
@@ -0,0 +1,37 @@
+package pandoc
+
+import (
+	"fmt"
+	"os"
+)
+
+// newWorkDir creates a private directory for the temporary files of one
+// conversion, readable only by the server user. The returned function
+// removes it with everything inside.
+func newWorkDir() (string, func(), error) {
+	dir, err := os.MkdirTemp("", "pandoc-request-*")
+	if err != nil {
+		return "", func() {}, fmt.Errorf("failed to create working directory: %v", err)
+	}
+	// MkdirTemp already uses 0700, but a permissive umask on some systems is not trusted
+	if err := os.Chmod(dir, 0700); err != nil {
+		os.RemoveAll(dir)
+		return "", func() {}, fmt.Errorf("failed to secure working directory: %v", err)
+	}
+	return dir, func() { os.RemoveAll(dir) }, nil
+}
+
+// writeWorkFile writes data to a new file in the working directory and
+// returns its path
+func writeWorkFile(dir, pattern string, data []byte) (string, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return "", fmt.Errorf("failed to write temporary file: %v", err)
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,362 @@
+// Package sandbox decides which files the server may read and write on
+// behalf of a client.
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Kinds of file access
+const (
+	AccessRead  = "read"
+	AccessWrite = "write"
+)
+
+// Reasons a path is rejected
+const (
+	ReasonOutsideRoots = "outside_allowed_roots"
+	ReasonDenied       = "denied_path"
+	ReasonInvalid      = "invalid_path"
+)
+
+// defaultDenyPaths are never accessible, even inside an allowed root.
+// Entries without a path separator match the file name anywhere.
+var defaultDenyPaths = []string{
+	"/etc/shadow",
+	"/etc/gshadow",
+	"/etc/sudoers",
+	"/etc/sudoers.d",
+	"/proc",
+	"/sys",
+	"/dev",
+	"~/.ssh",
+	"~/.gnupg",
+	"~/.aws",
+	"~/.azure",
+	"~/.kube",
+	"~/.docker",
+	"~/.config/gcloud",
+	"~/.netrc",
+	"~/.git-credentials",
+	".env",
+	"id_rsa*",
+	"id_ecdsa*",
+	"id_ed25519*",
+	"*.pem",
+	"*.key",
+}
+
+// PathError reports a path rejected by the policy
+type PathError struct {
+	Path     string `json:"path"`
+	Resolved string `json:"resolved_path,omitempty"`
+	Access   string `json:"access"`
+	Reason   string `json:"reason"`
+	// Roots are the roots allowed for the access, to help the client pick a valid path
+	Roots []string `json:"allowed_roots,omitempty"`
+}
+
+func (e *PathError) Error() string {
+	switch e.Reason {
+	case ReasonOutsideRoots:
+		return fmt.Sprintf("%s access to %s denied: path is outside the allowed roots", e.Access, e.Path)
+	case ReasonDenied:
+		return fmt.Sprintf("%s access to %s denied: path is on the deny list", e.Access, e.Path)
+	}
+	return fmt.Sprintf("%s access to %s denied: invalid path", e.Access, e.Path)
+}
+
+// Kind reports the error kind clients see in tool error results
+func (e *PathError) Kind() string { return "path_denied" }
+
+// Hint suggests how to pick a path the policy allows
+func (e *PathError) Hint() string {
+	if e.Reason == ReasonOutsideRoots {
+		return "Use a path inside one of allowed_roots."
+	}
+	return "Use another path; this one is not accessible through the server."
+}
+
+// Policy holds the allowed roots and denied paths. Roots shared by reads and
+// writes come from configuration; reads and writes may each have further
+// roots of their own. The MCP client's roots/list can only narrow the
+// configured roots, never widen them. When no root is configured and the
+// client announces none, every path outside the deny list is allowed.
+type Policy struct {
+	roots      []string
+	readRoots  []string
+	writeRoots []string
+	deny       []string
+	denyNames  []string
+
+	mu          sync.RWMutex
+	clientRoots []string
+}
+
+// New creates a policy. Roots and deny paths are made absolute and resolved
+// through symlinks; "~" expands to the home directory.
+func New(roots, readRoots, writeRoots, deny []string) *Policy {
+	p := &Policy{
+		roots:      resolveAll(roots),
+		readRoots:  resolveAll(readRoots),
+		writeRoots: resolveAll(writeRoots),
+	}
+	for _, entry := range deny {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.ContainsAny(entry, `/\`) {
+			p.denyNames = append(p.denyNames, entry)
+			continue
+		}
+		if resolved, err := resolve(entry); err == nil {
+			p.deny = append(p.deny, resolved)
+		}
+	}
+	return p
+}
+
+// FromEnv creates a policy from PANDOC_ALLOWED_ROOTS, PANDOC_READ_ROOTS,
+// PANDOC_WRITE_ROOTS and PANDOC_DENY_PATHS, each a list separated like PATH.
+// PANDOC_DENY_PATHS adds to the built-in deny list.
+func FromEnv() *Policy {
+	deny := append([]string{}, defaultDenyPaths...)
+	deny = append(deny, splitList(os.Getenv("PANDOC_DENY_PATHS"))...)
+	return New(
+		splitList(os.Getenv("PANDOC_ALLOWED_ROOTS")),
+		splitList(os.Getenv("PANDOC_READ_ROOTS")),
+		splitList(os.Getenv("PANDOC_WRITE_ROOTS")),
+		deny,
+	)
+}
+
+// SetClientRoots replaces the roots announced by the MCP client. Roots are
+// file:// URIs or plain paths. When roots are configured, client roots that
+// share no directory with any of them are ignored and returned, so the
+// client cannot gain access the configuration does not grant.
+func (p *Policy) SetClientRoots(uris []string) []string {
+	var roots []string
+	for _, uri := range uris {
+		if path, ok := pathFromURI(uri); ok {
+			roots = append(roots, path)
+		}
+	}
+
+	configured := append(append(append([]string{}, p.roots...), p.readRoots...), p.writeRoots...)
+	var accepted, ignored []string
+	for _, root := range resolveAll(roots) {
+		if len(configured) == 0 || len(intersect([]string{root}, configured)) > 0 {
+			accepted = append(accepted, root)
+		} else {
+			ignored = append(ignored, root)
+		}
+	}
+
+	p.mu.Lock()
+	p.clientRoots = accepted
+	p.mu.Unlock()
+	return ignored
+}
+
+// Restricted checks if any root is configured
+func (p *Policy) Restricted() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.roots)+len(p.readRoots)+len(p.writeRoots)+len(p.clientRoots) > 0
+}
+
+// Roots returns the roots allowed for the access: the configured roots,
+// narrowed to the client's roots when the client announced any
+func (p *Policy) Roots(access string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	roots := append([]string{}, p.roots...)
+	if access == AccessWrite {
+		roots = append(roots, p.writeRoots...)
+	} else {
+		roots = append(roots, p.readRoots...)
+	}
+
+	switch {
+	case len(p.clientRoots) == 0:
+		return roots
+	case len(p.roots)+len(p.readRoots)+len(p.writeRoots) == 0:
+		return append([]string{}, p.clientRoots...)
+	}
+	return intersect(p.clientRoots, roots)
+}
+
+// CheckRead checks that path may be read and returns it resolved
+func (p *Policy) CheckRead(path string) (string, error) {
+	return p.check(path, AccessRead)
+}
+
+// CheckWrite checks that path may be written and returns it resolved. The
+// file itself does not have to exist yet.
+func (p *Policy) CheckWrite(path string) (string, error) {
+	return p.check(path, AccessWrite)
+}
+
+// check resolves path and matches it against the deny list and the roots
+func (p *Policy) check(path, access string) (string, error) {
+	resolved, err := resolve(path)
+	if err != nil {
+		return "", &PathError{Path: path, Access: access, Reason: ReasonInvalid}
+	}
+
+	if p.denied(resolved) {
+		return "", &PathError{Path: path, Resolved: resolved, Access: access, Reason: ReasonDenied}
+	}
+
+	if !p.Restricted() {
+		return resolved, nil
+	}
+	roots := p.Roots(access)
+	for _, root := range roots {
+		if within(resolved, root) {
+			return resolved, nil
+		}
+	}
+	return "", &PathError{Path: path, Resolved: resolved, Access: access, Reason: ReasonOutsideRoots, Roots: roots}
+}
+
+// denied checks path against the deny list
+func (p *Policy) denied(path string) bool {
+	for _, deny := range p.deny {
+		if within(path, deny) {
+			return true
+		}
+	}
+	for dir := path; ; dir = filepath.Dir(dir) {
+		name := filepath.Base(dir)
+		for _, pattern := range p.denyNames {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				return true
+			}
+		}
+		if filepath.Dir(dir) == dir {
+			return false
+		}
+	}
+}
+
+// resolve returns the absolute path with symlinks resolved. For a path that
+// does not exist yet, its deepest existing parent is resolved instead.
+func resolve(path string) (string, error) {
+	if path == "" || strings.ContainsRune(path, 0) {
+		return "", errors.New("empty or invalid path")
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	var missing []string
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		real, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			for i := len(missing) - 1; i >= 0; i-- {
+				real = filepath.Join(real, missing[i])
+			}
+			return real, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) || filepath.Dir(dir) == dir {
+			return "", err
+		}
+		missing = append(missing, filepath.Base(dir))
+	}
+}
+
+// resolveAll resolves paths, skipping those that cannot be resolved
+func resolveAll(paths []string) []string {
+	var result []string
+	for _, path := range paths {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		if resolved, err := resolve(path); err == nil {
+			result = append(result, resolved)
+		}
+	}
+	return result
+}
+
+// intersect returns the directories inside both a root of a and a root of b:
+// for each overlapping pair the inner one of the two
+func intersect(a, b []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, x := range a {
+		for _, y := range b {
+			inner := ""
+			switch {
+			case within(x, y):
+				inner = x
+			case within(y, x):
+				inner = y
+			default:
+				continue
+			}
+			if !seen[inner] {
+				seen[inner] = true
+				result = append(result, inner)
+			}
+		}
+	}
+	return result
+}
+
+// within checks if path is root or inside it
+func within(path, root string) bool {
+	if runtime.GOOS == "windows" {
+		path, root = strings.ToLower(path), strings.ToLower(root)
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel))
+}
+
+// pathFromURI converts a file:// root URI to a path
+func pathFromURI(uri string) (string, bool) {
+	if !strings.Contains(uri, "://") {
+		return uri, uri != ""
+	}
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	path := u.Path
+	// file:///C:/docs has the path /C:/docs on Windows
+	if runtime.GOOS == "windows" && len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path), true
+}
+
+// splitList splits a PATH-style list
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return filepath.SplitList(value)
+}
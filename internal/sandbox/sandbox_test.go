@@ -0,0 +1,244 @@
+package sandbox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fixture is a directory tree for policy tests:
+//
+//	root/doc.md, root/sub/doc.md, root/escape -> outside, root/secret.pem
+//	outside/doc.md
+//	read/doc.md, write/
+type fixture struct {
+	dir, root, outside, read, write string
+}
+
+func newFixture(t *testing.T) fixture {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := fixture{
+		dir:     dir,
+		root:    filepath.Join(dir, "root"),
+		outside: filepath.Join(dir, "outside"),
+		read:    filepath.Join(dir, "read"),
+		write:   filepath.Join(dir, "write"),
+	}
+	for _, d := range []string{filepath.Join(f.root, "sub"), f.outside, f.read, f.write} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{
+		filepath.Join(f.root, "doc.md"),
+		filepath.Join(f.root, "sub", "doc.md"),
+		filepath.Join(f.root, "secret.pem"),
+		filepath.Join(f.outside, "doc.md"),
+		filepath.Join(f.read, "doc.md"),
+	} {
+		if err := os.WriteFile(file, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(f.outside, filepath.Join(f.root, "escape")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	return f
+}
+
+func TestPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy func(f fixture) *Policy
+		access string
+		path   func(f fixture) string
+		// wantReason is the PathError reason, empty when the path is allowed
+		wantReason string
+	}{
+		{
+			name:   "file inside the root",
+			policy: func(f fixture) *Policy { return New([]string{f.root}, nil, nil, nil) },
+			access: AccessRead,
+			path:   func(f fixture) string { return filepath.Join(f.root, "sub", "doc.md") },
+		},
+		{
+			name:   "parent traversal that stays inside the root",
+			policy: func(f fixture) *Policy { return New([]string{f.root}, nil, nil, nil) },
+			access: AccessRead,
+			path:   func(f fixture) string { return f.root + "/sub/../doc.md" },
+		},
+		{
+			name:       "parent traversal out of the root",
+			policy:     func(f fixture) *Policy { return New([]string{f.root}, nil, nil, nil) },
+			access:     AccessRead,
+			path:       func(f fixture) string { return f.root + "/sub/../../outside/doc.md" },
+			wantReason: ReasonOutsideRoots,
+		},
+		{
+			name:       "parent traversal to write out of the root",
+			policy:     func(f fixture) *Policy { return New([]string{f.root}, nil, nil, nil) },
+			access:     AccessWrite,
+			path:       func(f fixture) string { return f.root + "/../outside/new/out.html" },
+			wantReason: ReasonOutsideRoots,
+		},
+		{
+			name:       "symlink out of the root",
+			policy:     func(f fixture) *Policy { return New([]string{f.root}, nil, nil, nil) },
+			access:     AccessRead,
+			path:       func(f fixture) string { return filepath.Join(f.root, "escape", "doc.md") },
+			wantReason: ReasonOutsideRoots,
+		},
+		{
+			name:       "new file under a symlink out of the root",
+			policy:     func(f fixture) *Policy { return New([]string{f.root}, nil, nil, nil) },
+			access:     AccessWrite,
+			path:       func(f fixture) string { return filepath.Join(f.root, "escape", "new", "out.html") },
+			wantReason: ReasonOutsideRoots,
+		},
+		{
+			name:       "denied file name inside the root",
+			policy:     func(f fixture) *Policy { return New([]string{f.root}, nil, nil, []string{"*.pem"}) },
+			access:     AccessRead,
+			path:       func(f fixture) string { return filepath.Join(f.root, "secret.pem") },
+			wantReason: ReasonDenied,
+		},
+		{
+			name:       "denied directory without roots",
+			policy:     func(f fixture) *Policy { return New(nil, nil, nil, []string{f.outside}) },
+			access:     AccessRead,
+			path:       func(f fixture) string { return filepath.Join(f.outside, "doc.md") },
+			wantReason: ReasonDenied,
+		},
+		{
+			name:       "denied directory reached through a symlink",
+			policy:     func(f fixture) *Policy { return New(nil, nil, nil, []string{f.outside}) },
+			access:     AccessRead,
+			path:       func(f fixture) string { return filepath.Join(f.root, "escape", "doc.md") },
+			wantReason: ReasonDenied,
+		},
+		{
+			name:   "no roots allow everything outside the deny list",
+			policy: func(f fixture) *Policy { return New(nil, nil, nil, []string{"*.pem"}) },
+			access: AccessWrite,
+			path:   func(f fixture) string { return filepath.Join(f.outside, "out.html") },
+		},
+		{
+			name:   "read root is readable",
+			policy: func(f fixture) *Policy { return New(nil, []string{f.read}, []string{f.write}, nil) },
+			access: AccessRead,
+			path:   func(f fixture) string { return filepath.Join(f.read, "doc.md") },
+		},
+		{
+			name:       "read root is not writable",
+			policy:     func(f fixture) *Policy { return New(nil, []string{f.read}, []string{f.write}, nil) },
+			access:     AccessWrite,
+			path:       func(f fixture) string { return filepath.Join(f.read, "out.html") },
+			wantReason: ReasonOutsideRoots,
+		},
+		{
+			name:   "write root is writable",
+			policy: func(f fixture) *Policy { return New(nil, []string{f.read}, []string{f.write}, nil) },
+			access: AccessWrite,
+			path:   func(f fixture) string { return filepath.Join(f.write, "out.html") },
+		},
+		{
+			name:       "write root is not readable",
+			policy:     func(f fixture) *Policy { return New(nil, []string{f.read}, []string{f.write}, nil) },
+			access:     AccessRead,
+			path:       func(f fixture) string { return filepath.Join(f.write, "out.html") },
+			wantReason: ReasonOutsideRoots,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			assertCheck(t, tt.policy(f), tt.access, tt.path(f), tt.wantReason)
+		})
+	}
+}
+
+// assertCheck checks path against policy and compares the rejection reason
+// with wantReason, empty when the path must be allowed
+func assertCheck(t *testing.T, policy *Policy, access, path, wantReason string) {
+	t.Helper()
+	_, err := policy.check(path, access)
+	if wantReason == "" {
+		if err != nil {
+			t.Errorf("%s %s: %v, want it allowed", access, path, err)
+		}
+		return
+	}
+	var pathErr *PathError
+	if !errors.As(err, &pathErr) {
+		t.Fatalf("%s %s: error %v, want %s", access, path, err, wantReason)
+	}
+	if pathErr.Reason != wantReason {
+		t.Errorf("%s %s: reason %s, want %s", access, path, pathErr.Reason, wantReason)
+	}
+}
+
+func TestDefaultDenyList(t *testing.T) {
+	f := newFixture(t)
+	t.Setenv("PANDOC_ALLOWED_ROOTS", f.root)
+	t.Setenv("PANDOC_READ_ROOTS", "")
+	t.Setenv("PANDOC_WRITE_ROOTS", "")
+	t.Setenv("PANDOC_DENY_PATHS", filepath.Join(f.root, "sub"))
+	policy := FromEnv()
+
+	assertCheck(t, policy, AccessRead, filepath.Join(f.root, "secret.pem"), ReasonDenied)
+	assertCheck(t, policy, AccessWrite, filepath.Join(f.root, ".env"), ReasonDenied)
+	assertCheck(t, policy, AccessRead, filepath.Join(f.root, "sub", "doc.md"), ReasonDenied)
+	assertCheck(t, policy, AccessRead, "/etc/shadow", ReasonDenied)
+	assertCheck(t, policy, AccessRead, filepath.Join(f.root, "doc.md"), "")
+}
+
+func TestSetClientRootsOnlyNarrows(t *testing.T) {
+	f := newFixture(t)
+	sub := filepath.Join(f.root, "sub")
+
+	t.Run("inner and unrelated roots", func(t *testing.T) {
+		policy := New([]string{f.root}, nil, nil, nil)
+		ignored := policy.SetClientRoots([]string{"file://" + filepath.ToSlash(sub), f.outside})
+		if want := []string{f.outside}; !reflect.DeepEqual(ignored, want) {
+			t.Errorf("ignored roots = %v, want %v", ignored, want)
+		}
+		if got, want := policy.Roots(AccessRead), []string{sub}; !reflect.DeepEqual(got, want) {
+			t.Errorf("read roots = %v, want %v", got, want)
+		}
+		assertCheck(t, policy, AccessRead, filepath.Join(sub, "doc.md"), "")
+		assertCheck(t, policy, AccessRead, filepath.Join(f.root, "doc.md"), ReasonOutsideRoots)
+		assertCheck(t, policy, AccessRead, filepath.Join(f.outside, "doc.md"), ReasonOutsideRoots)
+	})
+
+	t.Run("wider root", func(t *testing.T) {
+		policy := New([]string{f.root}, nil, nil, nil)
+		if ignored := policy.SetClientRoots([]string{f.dir}); len(ignored) != 0 {
+			t.Errorf("ignored roots = %v, want none", ignored)
+		}
+		if got, want := policy.Roots(AccessWrite), []string{f.root}; !reflect.DeepEqual(got, want) {
+			t.Errorf("write roots = %v, want %v", got, want)
+		}
+		assertCheck(t, policy, AccessWrite, filepath.Join(f.outside, "out.html"), ReasonOutsideRoots)
+	})
+
+	t.Run("only unrelated roots", func(t *testing.T) {
+		policy := New([]string{f.root}, nil, nil, nil)
+		policy.SetClientRoots([]string{f.outside})
+		assertCheck(t, policy, AccessRead, filepath.Join(f.root, "doc.md"), "")
+		assertCheck(t, policy, AccessRead, filepath.Join(f.outside, "doc.md"), ReasonOutsideRoots)
+	})
+
+	t.Run("no configured roots", func(t *testing.T) {
+		policy := New(nil, nil, nil, nil)
+		policy.SetClientRoots([]string{sub})
+		assertCheck(t, policy, AccessRead, filepath.Join(sub, "doc.md"), "")
+		assertCheck(t, policy, AccessRead, filepath.Join(f.outside, "doc.md"), ReasonOutsideRoots)
+	})
+}
@@ -0,0 +1,478 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/logging"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/sandbox"
+)
+
+// Limits of batch conversions
+const (
+	// defaultBatchParallel is the number of items converted at once unless
+	// max_parallel says otherwise
+	defaultBatchParallel = 4
+	// maxBatchParallel keeps one batch from filling the scheduler's queue
+	maxBatchParallel = 16
+	// maxBatchItems bounds the number of conversions in one call
+	maxBatchItems = 1000
+)
+
+// batchJob is one conversion of a batch
+type batchJob struct {
+	inputFile    string
+	outputFile   string
+	inputFormat  string
+	outputFormat string
+	// args are the batch options overridden by the job's own
+	args map[string]any
+	// err fails the job without converting, e.g. when its output file could
+	// not be named
+	err error
+}
+
+// BatchItem is the outcome of one conversion of a batch
+type BatchItem struct {
+	InputFile    string           `json:"input_file"`
+	OutputFile   string           `json:"output_file,omitempty"`
+	InputFormat  string           `json:"input_format,omitempty"`
+	OutputFormat string           `json:"output_format,omitempty"`
+	Success      bool             `json:"success"`
+	Cached       bool             `json:"cached,omitempty"`
+	Warnings     []pandoc.Warning `json:"warnings,omitempty"`
+	// Error, Message and Hint describe a failure as in error results
+	Error      string `json:"error,omitempty"`
+	Message    string `json:"message,omitempty"`
+	Hint       string `json:"hint,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// BatchResult is the outcome of a batch, one item per conversion in order
+type BatchResult struct {
+	Total      int         `json:"total"`
+	Succeeded  int         `json:"succeeded"`
+	Failed     int         `json:"failed"`
+	DurationMS int64       `json:"duration_ms"`
+	Items      []BatchItem `json:"items"`
+}
+
+// ConvertBatch converts many files in one call, given as a list of jobs or
+// as a glob with an output directory. A failed item does not stop the others.
+func (h *Handler) ConvertBatch(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	logger := logging.GetGlobalLogger()
+	logger.DetailedInfo("Начало обработки запроса convert_batch")
+	ctx = pandoc.WithClient(ctx, sessionKey(ctx))
+	args := req.Params.Arguments
+
+	// Options shared by every job are checked once, so a mistake fails the
+	// call instead of every item
+	if _, err := parseOptions(args); err != nil {
+		logger.Error("Некорректные параметры конвертации: %v", err)
+		return errorResult(err)
+	}
+	parallel, err := parallelArg(args)
+	if err != nil {
+		logger.Error("Некорректный параметр max_parallel: %v", err)
+		return errorResult(err)
+	}
+	jobs, err := parseBatchJobs(h.policy, args)
+	if err != nil {
+		logger.Error("Некорректное задание пакетной конвертации: %v", err)
+		return errorResult(err)
+	}
+
+	logger.Info("Пакетная конвертация: %d файлов, параллельно %d", len(jobs), parallel)
+	result := h.runBatch(ctx, jobs, parallel)
+	logger.Info("Пакетная конвертация завершена: успешно %d из %d за %d мс", result.Succeeded, result.Total, result.DurationMS)
+
+	jsonData, _ := json.Marshal(result)
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+// runBatch converts jobs, at most parallel at once, and collects their
+// results in the order of jobs
+func (h *Handler) runBatch(ctx context.Context, jobs []batchJob, parallel int) *BatchResult {
+	start := time.Now()
+	items := make([]BatchItem, len(jobs))
+
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			items[i] = h.convertBatchItem(ctx, job)
+		}()
+	}
+	wg.Wait()
+
+	result := &BatchResult{Total: len(items), Items: items, DurationMS: time.Since(start).Milliseconds()}
+	for _, item := range items {
+		if item.Success {
+			result.Succeeded++
+		} else {
+			result.Failed++
+		}
+	}
+	return result
+}
+
+// convertBatchItem runs one job and reports its outcome
+func (h *Handler) convertBatchItem(ctx context.Context, job batchJob) BatchItem {
+	logger := logging.GetGlobalLogger()
+	start := time.Now()
+	item := BatchItem{InputFile: job.inputFile, OutputFile: job.outputFile}
+
+	converted, err := h.convertJob(ctx, job, &item)
+	item.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		item.Error, item.Message, item.Hint = pandoc.ErrorKind(err), err.Error(), pandoc.ErrorHint(err)
+		logger.ConversionOperation(item.InputFormat, item.OutputFormat, fmt.Sprintf("%s: ошибка: %v", job.inputFile, err), false)
+		return item
+	}
+
+	item.Success = true
+	item.OutputFile = converted.OutputFile
+	item.Cached = converted.Cached
+	item.Warnings = converted.Warnings
+	logger.ConversionOperation(item.InputFormat, item.OutputFormat, fmt.Sprintf("%s → %s", job.inputFile, converted.OutputFile), true)
+	for _, w := range converted.Warnings {
+		logger.Warn("Предупреждение Pandoc (%s) в %s: %s", w.Type, job.inputFile, w.Message)
+	}
+	return item
+}
+
+// convertJob checks the paths and formats of job like convert_contents
+// does, records the formats in item and converts the file
+func (h *Handler) convertJob(ctx context.Context, job batchJob, item *BatchItem) (*pandoc.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if job.err != nil {
+		return nil, job.err
+	}
+	opts, err := parseOptions(job.args)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := h.resolveConversion(conversionRequest{
+		inputFiles:   []string{job.inputFile},
+		inputFormat:  job.inputFormat,
+		outputFormat: job.outputFormat,
+		outputFile:   job.outputFile,
+	}, &opts)
+	if err != nil {
+		// Report the formats that were rejected
+		var formatErr *pandoc.FormatError
+		if errors.As(err, &formatErr) {
+			item.InputFormat, item.OutputFormat = formatErr.Input, formatErr.Output
+		}
+		return nil, err
+	}
+	item.InputFormat, item.OutputFormat = resolved.inputFormat, resolved.outputFormat
+
+	return h.converter.ConvertFile(ctx, resolved.inputFiles[0], resolved.inputFormat, resolved.outputFormat, resolved.outputFile, opts)
+}
+
+// parallelArg returns the max_parallel argument, defaultBatchParallel if it
+// is absent
+func parallelArg(args map[string]any) (int, error) {
+	parallel, err := intArg(args, "max_parallel")
+	if err != nil {
+		return 0, err
+	}
+	if parallel == 0 {
+		return defaultBatchParallel, nil
+	}
+	if parallel < 1 || parallel > maxBatchParallel {
+		return 0, &pandoc.ArgumentError{Argument: "max_parallel", Reason: fmt.Sprintf("must be between 1 and %d", maxBatchParallel)}
+	}
+	return parallel, nil
+}
+
+// parseBatchJobs builds the jobs of a batch from the jobs argument or from
+// the glob, output_dir and extensions arguments
+func parseBatchJobs(policy *sandbox.Policy, args map[string]any) ([]batchJob, error) {
+	jobList, err := objectListArg(args, "jobs")
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := stringArg(args, "glob")
+	if err != nil {
+		return nil, err
+	}
+	inputFormat, err := stringArg(args, "input_format")
+	if err != nil {
+		return nil, err
+	}
+	outputFormat, err := stringArg(args, "output_format")
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []batchJob
+	switch {
+	case len(jobList) > 0 && pattern != "":
+		return nil, &pandoc.ArgumentError{Argument: "glob", Reason: "only one of jobs and glob may be provided"}
+	case len(jobList) > 0:
+		if len(jobList) > maxBatchItems {
+			return nil, &pandoc.ArgumentError{Argument: "jobs", Reason: fmt.Sprintf("at most %d jobs are allowed", maxBatchItems)}
+		}
+		for i, obj := range jobList {
+			job, err := parseJob(obj, fmt.Sprintf("jobs[%d]", i), args, inputFormat, outputFormat)
+			if err != nil {
+				return nil, err
+			}
+			jobs = append(jobs, job)
+		}
+	case pattern != "":
+		if jobs, err = globJobs(policy, args, pattern, inputFormat, outputFormat); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, &pandoc.ArgumentError{Argument: "jobs", Reason: "one of jobs or glob must be provided"}
+	}
+	failDuplicateOutputs(jobs)
+	return jobs, nil
+}
+
+// failDuplicateOutputs fails every job whose output file is also the output
+// of another job, e.g. a.md and a.rst both becoming a.html, instead of
+// letting one silently replace the other
+func failDuplicateOutputs(jobs []batchJob) {
+	byOutput := make(map[string][]int)
+	for i, job := range jobs {
+		if job.err == nil {
+			key := filepath.Clean(pandoc.NormalizePath(job.outputFile))
+			byOutput[key] = append(byOutput[key], i)
+		}
+	}
+	for outputFile, indexes := range byOutput {
+		if len(indexes) < 2 {
+			continue
+		}
+		inputs := make([]string, len(indexes))
+		for n, i := range indexes {
+			inputs[n] = jobs[i].inputFile
+		}
+		for _, i := range indexes {
+			jobs[i].err = &pandoc.ArgumentError{
+				Argument: "output_file",
+				Reason:   fmt.Sprintf("%s is the output of %s; map their extensions to different ones or convert them separately", outputFile, strings.Join(inputs, ", ")),
+			}
+		}
+	}
+}
+
+// parseJob reads one element of the jobs argument. Formats it does not give
+// default to the batch formats, and its options override the batch options.
+func parseJob(obj map[string]any, name string, args map[string]any, inputFormat, outputFormat string) (batchJob, error) {
+	job := batchJob{inputFormat: inputFormat, outputFormat: outputFormat}
+	var err error
+	if job.inputFile, err = stringArg(obj, "input_file"); err != nil || job.inputFile == "" {
+		return job, &pandoc.ArgumentError{Argument: name + ".input_file", Reason: "must be a non-empty string"}
+	}
+	if job.outputFile, err = stringArg(obj, "output_file"); err != nil || job.outputFile == "" {
+		return job, &pandoc.ArgumentError{Argument: name + ".output_file", Reason: "must be a non-empty string"}
+	}
+	if format, err := stringArg(obj, "input_format"); err != nil {
+		return job, &pandoc.ArgumentError{Argument: name + ".input_format", Reason: "must be a string"}
+	} else if format != "" {
+		job.inputFormat = format
+	}
+	if format, err := stringArg(obj, "output_format"); err != nil {
+		return job, &pandoc.ArgumentError{Argument: name + ".output_format", Reason: "must be a string"}
+	} else if format != "" {
+		job.outputFormat = format
+	}
+
+	job.args = args
+	if options, ok := obj["options"]; ok && options != nil {
+		overrides, ok := options.(map[string]any)
+		if !ok {
+			return job, &pandoc.ArgumentError{Argument: name + ".options", Reason: "must be an object"}
+		}
+		job.args = mergeArgs(args, overrides)
+	}
+	return job, nil
+}
+
+// globJobs creates a job for every file matching pattern, written under
+// output_dir at the same relative path with the extension mapped by the
+// extensions argument or taken from the output format
+func globJobs(policy *sandbox.Policy, args map[string]any, pattern, inputFormat, outputFormat string) ([]batchJob, error) {
+	outputDir, err := stringArg(args, "output_dir")
+	if err != nil {
+		return nil, err
+	}
+	if outputDir == "" {
+		return nil, &pandoc.ArgumentError{Argument: "output_dir", Reason: "required with glob"}
+	}
+	outputDir = filepath.Clean(pandoc.NormalizePath(outputDir))
+	extensions, err := stringMapArg(args, "extensions")
+	if err != nil {
+		return nil, err
+	}
+
+	pattern = filepath.Clean(pandoc.NormalizePath(pattern))
+	base := globBase(pattern)
+	// Don't list directories the client may not read
+	if _, err := checkPath(policy, base, sandbox.AccessRead); err != nil {
+		return nil, err
+	}
+	files, err := globFiles(pattern, base, outputDir, maxBatchItems)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, &pandoc.ArgumentError{Argument: "glob", Reason: fmt.Sprintf("no files match %s", pattern)}
+	}
+
+	jobs := make([]batchJob, 0, len(files))
+	for _, file := range files {
+		job := batchJob{inputFile: file, inputFormat: inputFormat, outputFormat: outputFormat, args: args}
+		rel, err := filepath.Rel(base, file)
+		if err != nil {
+			job.err = err
+			jobs = append(jobs, job)
+			continue
+		}
+		ext := filepath.Ext(rel)
+		outputExt, ok := mapExtension(extensions, ext)
+		switch {
+		case ok:
+		case outputFormat != "":
+			outputExt = pandoc.FileExtension(outputFormat)
+		default:
+			job.err = &pandoc.ArgumentError{Argument: "extensions", Reason: fmt.Sprintf("no output extension for %s files and no output_format", ext)}
+		}
+		if job.err == nil {
+			job.outputFile = filepath.Join(outputDir, strings.TrimSuffix(rel, ext)+outputExt)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// mapExtension looks up the output extension of ext, e.g. ".md", in the
+// extensions argument, whose keys and values may be given with or without
+// the leading dot
+func mapExtension(extensions map[string]string, ext string) (string, bool) {
+	mapped, ok := extensions[ext]
+	if !ok {
+		mapped, ok = extensions[strings.TrimPrefix(ext, ".")]
+	}
+	if !ok {
+		return "", false
+	}
+	return "." + strings.TrimPrefix(mapped, "."), true
+}
+
+// mergeArgs returns args with the values of overrides replacing theirs
+func mergeArgs(args, overrides map[string]any) map[string]any {
+	merged := make(map[string]any, len(args)+len(overrides))
+	for key, value := range args {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
+
+// globBase returns the directory of pattern before its first wildcard
+func globBase(pattern string) string {
+	base := pattern
+	for strings.ContainsAny(base, "*?[") {
+		base = filepath.Dir(base)
+	}
+	return base
+}
+
+// globFiles returns the regular files under base matching pattern, in
+// lexical order. Besides the wildcards of filepath.Match, a "**" path
+// element matches any number of directories. Hidden files and directories
+// below base are skipped, like outputDir, which holds the outputs of earlier
+// runs, and the walk stops with an error once more than limit files match.
+func globFiles(pattern, base, outputDir string, limit int) ([]string, error) {
+	if _, err := path.Match(filepath.ToSlash(pattern), ""); err != nil {
+		return nil, &pandoc.ArgumentError{Argument: "glob", Reason: fmt.Sprintf("invalid pattern: %v", err)}
+	}
+	patternParts := strings.Split(filepath.ToSlash(pattern), "/")
+
+	var files []string
+	err := filepath.WalkDir(base, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if file == base {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") || isWithin(outputDir, file) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && matchGlob(patternParts, strings.Split(filepath.ToSlash(file), "/")) {
+			if len(files) == limit {
+				return &pandoc.ArgumentError{Argument: "glob", Reason: fmt.Sprintf("matches more than %d files, the most allowed", limit)}
+			}
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		var argErr *pandoc.ArgumentError
+		if errors.As(err, &argErr) {
+			return nil, err
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, &pandoc.InputNotFoundError{Path: base}
+		}
+		return nil, fmt.Errorf("failed to list files matching %s: %v", pattern, err)
+	}
+	return files, nil
+}
+
+// matchGlob matches the elements of a path against those of a pattern
+func matchGlob(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchGlob(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// isWithin reports whether file is inside dir
+func isWithin(dir, file string) bool {
+	rel, err := filepath.Rel(dir, file)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
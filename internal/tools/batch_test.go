@@ -0,0 +1,39 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+)
+
+func TestGlobFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.md", "sub/b.md", ".hidden.md", ".git/c.md", "sub/.cache/d.md", "site/e.md", "notes.txt"} {
+		writeFile(t, filepath.Join(dir, name), "x")
+	}
+	pattern := filepath.Join(dir, "**", "*.md")
+	outputDir := filepath.Join(dir, "site")
+
+	files, err := globFiles(pattern, dir, outputDir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "a.md"), filepath.Join(dir, "sub", "b.md")}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("globFiles() = %v, want %v", files, want)
+	}
+
+	// The walk stops at the first match over the limit
+	for i := range 5 {
+		writeFile(t, filepath.Join(dir, "many", fmt.Sprintf("%d.md", i)), "x")
+	}
+	_, err = globFiles(pattern, dir, outputDir, 3)
+	var argErr *pandoc.ArgumentError
+	if !errors.As(err, &argErr) || argErr.Argument != "glob" {
+		t.Errorf("globFiles() over the limit = %v, want a glob argument error", err)
+	}
+}
@@ -0,0 +1,177 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/logging"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/sandbox"
+)
+
+// BuildBook assembles chapter files, given in order or by a manifest, into
+// one document with chapter breaks, a table of contents and one set of
+// metadata
+func (h *Handler) BuildBook(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	logger := logging.GetGlobalLogger()
+	logger.DetailedInfo("Начало обработки запроса build_book")
+	ctx = pandoc.WithClient(ctx, sessionKey(ctx))
+	args := req.Params.Arguments
+
+	opts, err := parseOptions(args)
+	if err != nil {
+		logger.Error("Некорректные параметры конвертации: %v", err)
+		return errorResult(err)
+	}
+	book, err := parseBook(h.policy, args)
+	if err != nil {
+		logger.Error("Некорректное описание книги: %v", err)
+		return errorResult(err)
+	}
+	inputFormat, err := stringArg(args, "input_format")
+	if err != nil {
+		return errorResult(err)
+	}
+	outputFormat, err := stringArg(args, "output_format")
+	if err != nil {
+		return errorResult(err)
+	}
+	outputFile, err := stringArg(args, "output_file")
+	if err != nil {
+		return errorResult(err)
+	}
+	if outputFile == "" {
+		return errorResult(&pandoc.ArgumentError{Argument: "output_file", Reason: "required"})
+	}
+
+	if err := applyBook(&opts, args, book); err != nil {
+		return errorResult(err)
+	}
+
+	// Check client-supplied paths against the sandbox policy and settle the formats
+	resolved, err := h.resolveConversion(conversionRequest{
+		inputFiles:   book.Chapters,
+		inputFormat:  inputFormat,
+		outputFormat: outputFormat,
+		outputFile:   outputFile,
+	}, &opts)
+	if err != nil {
+		return errorResult(err)
+	}
+	book.Chapters, outputFile = resolved.inputFiles, resolved.outputFile
+	inputFormat, outputFormat = resolved.inputFormat, resolved.outputFormat
+
+	logger.Info("Сборка книги: %d глав → %s (%s)", len(book.Chapters), outputFile, outputFormat)
+	converted, err := h.converter.ConvertFiles(ctx, book.Chapters, inputFormat, outputFormat, outputFile, opts)
+	if err != nil {
+		logger.ConversionOperation(inputFormat, outputFormat, fmt.Sprintf("Ошибка сборки книги: %v", err), false)
+		return errorResult(err)
+	}
+	logger.ConversionOperation(inputFormat, outputFormat, fmt.Sprintf("%d глав → %s", len(book.Chapters), converted.OutputFile), true)
+	for _, w := range converted.Warnings {
+		logger.Warn("Предупреждение Pandoc (%s): %s", w.Type, w.Message)
+	}
+
+	data := map[string]any{
+		"output_file":   converted.OutputFile,
+		"message":       fmt.Sprintf("Successfully built %s book from %d chapters: %s", outputFormat, len(book.Chapters), converted.OutputFile),
+		"chapters":      book.Chapters,
+		"input_format":  inputFormat,
+		"output_format": outputFormat,
+	}
+	if converted.OutputFile != outputFile {
+		data["requested_output_file"] = outputFile
+	}
+	if len(converted.Warnings) > 0 {
+		data["warnings"] = converted.Warnings
+	}
+	if converted.Cached {
+		data["cached"] = true
+	}
+	jsonData, _ := json.Marshal(data)
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+// parseBook reads the book from the manifest argument, if any, with the
+// chapters, title, authors and cover_image arguments taking precedence
+func parseBook(policy *sandbox.Policy, args map[string]any) (*pandoc.Book, error) {
+	manifest, err := stringArg(args, "manifest")
+	if err != nil {
+		return nil, err
+	}
+	book := &pandoc.Book{}
+	if manifest != "" {
+		if manifest, err = checkPath(policy, pandoc.NormalizePath(manifest), sandbox.AccessRead); err != nil {
+			return nil, err
+		}
+		if book, err = pandoc.LoadBook(manifest); err != nil {
+			return nil, err
+		}
+	}
+
+	chapters, err := stringListArg(args, "chapters")
+	if err != nil {
+		return nil, err
+	}
+	if len(chapters) > 0 {
+		book.Chapters = chapters
+	}
+	if len(book.Chapters) == 0 {
+		return nil, &pandoc.ArgumentError{Argument: "chapters", Reason: "one of chapters or a manifest listing chapters must be provided"}
+	}
+	for i, chapter := range book.Chapters {
+		if chapter == "" {
+			return nil, &pandoc.ArgumentError{Argument: fmt.Sprintf("chapters[%d]", i), Reason: "must be a non-empty path"}
+		}
+	}
+
+	if title, err := stringArg(args, "title"); err != nil {
+		return nil, err
+	} else if title != "" {
+		book.Title = title
+	}
+	if authors, err := stringListArg(args, "authors"); err != nil {
+		return nil, err
+	} else if len(authors) > 0 {
+		book.Authors = authors
+	}
+	if cover, err := stringArg(args, "cover_image"); err != nil {
+		return nil, err
+	} else if cover != "" {
+		book.CoverImage = cover
+	}
+	return book, nil
+}
+
+// applyBook sets the options that make the chapters one book: each chapter
+// is parsed on its own and starts a new chapter on a new page, the title and
+// authors replace those of the chapters, and a table of contents is
+// generated unless the toc argument turns it off
+func applyBook(opts *pandoc.Options, args map[string]any, book *pandoc.Book) error {
+	toc, err := optionalBool(args, "toc")
+	if err != nil {
+		return err
+	}
+	opts.TOC = toc == nil || *toc
+	opts.Standalone = true
+	opts.FileScope = true
+	opts.TopLevelDivision = "chapter"
+	opts.Filters = appendFilter(opts.Filters, pandoc.ChapterBreaksFilter)
+	opts.CoverImage = book.CoverImage
+
+	if book.Title != "" {
+		metadata := make(map[string]string, len(opts.Metadata)+1)
+		for key, value := range opts.Metadata {
+			metadata[key] = value
+		}
+		metadata["title"] = book.Title
+		opts.Metadata = metadata
+	}
+	if len(book.Authors) > 0 {
+		opts.Authors = book.Authors
+		delete(opts.Metadata, "author")
+	}
+	return nil
+}
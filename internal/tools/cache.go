@@ -0,0 +1,50 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/logging"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+)
+
+// CacheHandler serves the cache_stats and clear_cache tools
+type CacheHandler struct {
+	cache *pandoc.Cache
+}
+
+// NewCacheHandler creates the cache tool handlers; cache is nil when caching is off
+func NewCacheHandler(cache *pandoc.Cache) *CacheHandler {
+	return &CacheHandler{cache: cache}
+}
+
+// CacheStats reports the size of the conversion cache and its hit rate
+func (h *CacheHandler) CacheStats(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	logger := logging.GetGlobalLogger()
+	logger.DetailedInfo("Начало обработки запроса cache_stats")
+
+	stats := pandoc.CacheStats{}
+	if h.cache != nil {
+		stats = h.cache.Stats()
+	}
+	logger.Trace("Кэш: %d записей, %d байт, попаданий %d, промахов %d", stats.Entries, stats.SizeBytes, stats.Hits, stats.Misses)
+
+	jsonData, _ := json.Marshal(stats)
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+// ClearCache removes every cached conversion
+func (h *CacheHandler) ClearCache(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	logger := logging.GetGlobalLogger()
+	logger.DetailedInfo("Начало обработки запроса clear_cache")
+
+	removed := 0
+	if h.cache != nil {
+		removed = h.cache.Clear()
+	}
+	logger.Info("Кэш очищен: удалено записей %d", removed)
+
+	jsonData, _ := json.Marshal(map[string]any{"removed": removed})
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
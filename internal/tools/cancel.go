@@ -0,0 +1,153 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/logging"
+)
+
+// methodCancelled is the MCP notification a client sends to abort a request
+const methodCancelled = "notifications/cancelled"
+
+// CancelRegistry tracks in-flight tool calls so that notifications/cancelled
+// from the client can abort the matching conversion
+type CancelRegistry struct {
+	mu      sync.Mutex
+	pending map[string]string             // session ID → ID of the call about to run
+	active  map[string]context.CancelFunc // request ID → cancel of its context
+}
+
+// NewCancelRegistry creates an empty registry
+func NewCancelRegistry() *CancelRegistry {
+	return &CancelRegistry{
+		pending: make(map[string]string),
+		active:  make(map[string]context.CancelFunc),
+	}
+}
+
+// BeforeCallTool is a server hook that remembers the JSON-RPC ID of the tool
+// call the session is about to run, so Middleware can associate it with a context
+func (r *CancelRegistry) BeforeCallTool(ctx context.Context, id any, _ *mcp.CallToolRequest) {
+	r.mu.Lock()
+	r.pending[sessionKey(ctx)] = requestKey(id)
+	r.mu.Unlock()
+}
+
+// Middleware wraps a tool handler with a cancellable context registered under
+// the ID of the current request
+func (r *CancelRegistry) Middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		session := sessionKey(ctx)
+
+		r.mu.Lock()
+		id, ok := r.pending[session]
+		delete(r.pending, session)
+		r.mu.Unlock()
+		if !ok {
+			return next(ctx, req)
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		r.mu.Lock()
+		r.active[id] = cancel
+		r.mu.Unlock()
+
+		defer func() {
+			r.mu.Lock()
+			delete(r.active, id)
+			r.mu.Unlock()
+			cancel()
+		}()
+
+		return next(ctx, req)
+	}
+}
+
+// Cancel aborts the tool call with the given request ID, if it is still running
+func (r *CancelRegistry) Cancel(id any, reason string) bool {
+	key := requestKey(id)
+
+	r.mu.Lock()
+	cancel, ok := r.active[key]
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	logging.GetGlobalLogger().Info("Запрос %s отменен клиентом: %s", key, reason)
+	cancel()
+	return true
+}
+
+// HandleNotification is a notifications/cancelled handler for the MCP server
+func (r *CancelRegistry) HandleNotification(_ context.Context, notification mcp.JSONRPCNotification) {
+	fields := notification.Params.AdditionalFields
+	if id, ok := fields["requestId"]; ok {
+		reason, _ := fields["reason"].(string)
+		r.Cancel(id, reason)
+	}
+}
+
+// WatchInput returns a reader that forwards everything from in, acting on
+// notifications/cancelled as soon as they arrive. The stdio transport handles
+// messages one at a time, so without this a cancellation would only be read
+// after the conversion it refers to had already finished.
+func (r *CancelRegistry) WatchInput(in io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+
+	go func() {
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				r.inspect(line)
+				if _, werr := pw.Write(line); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	return pr
+}
+
+// inspect cancels the referenced request if line is a cancellation notification
+func (r *CancelRegistry) inspect(line []byte) {
+	var msg struct {
+		Method string `json:"method"`
+		Params struct {
+			RequestID any    `json:"requestId"`
+			Reason    string `json:"reason"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(line, &msg); err != nil || msg.Method != methodCancelled {
+		return
+	}
+	if msg.Params.RequestID != nil {
+		r.Cancel(msg.Params.RequestID, msg.Params.Reason)
+	}
+}
+
+// requestKey normalizes a JSON-RPC request ID (number or string) to a map key
+func requestKey(id any) string {
+	return fmt.Sprint(id)
+}
+
+// sessionKey identifies the client session of a request
+func sessionKey(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
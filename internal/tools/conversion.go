@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/logging"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/sandbox"
+)
+
+// conversionRequest is a conversion as the client asked for it. The input is
+// inputFiles, or contents or binary when there are none; formats left empty
+// are inferred.
+type conversionRequest struct {
+	inputFiles   []string
+	contents     string
+	binary       *binaryInput
+	inputFormat  string
+	outputFormat string
+	outputFile   string
+}
+
+// conversion is a request whose paths passed the sandbox policy, resolved,
+// and whose formats are known and supported
+type conversion struct {
+	inputFiles   []string
+	outputFile   string
+	inputFormat  string
+	outputFormat string
+	// inputFormatSource and outputFormatSource tell how the formats were found
+	inputFormatSource  string
+	outputFormatSource string
+}
+
+// resolveConversion applies the rules every conversion tool shares: the
+// input files, output file, bibliography and cover image are checked against
+// the sandbox policy and replaced in opts by their resolved paths, pandoc may
+// load images from their directories, missing formats are inferred, and PDF
+// input and formats pandoc cannot handle are rejected
+func (h *Handler) resolveConversion(req conversionRequest, opts *pandoc.Options) (*conversion, error) {
+	logger := logging.GetGlobalLogger()
+	c := &conversion{
+		inputFiles:         make([]string, len(req.inputFiles)),
+		inputFormat:        req.inputFormat,
+		outputFormat:       req.outputFormat,
+		inputFormatSource:  pandoc.FormatSourceArgument,
+		outputFormatSource: pandoc.FormatSourceArgument,
+	}
+
+	var err error
+	for i, inputFile := range req.inputFiles {
+		if c.inputFiles[i], err = checkPath(h.policy, pandoc.NormalizePath(inputFile), sandbox.AccessRead); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Bibliography != "" {
+		if opts.Bibliography, err = checkPath(h.policy, pandoc.NormalizePath(opts.Bibliography), sandbox.AccessRead); err != nil {
+			return nil, err
+		}
+	}
+	if opts.CoverImage != "" {
+		if opts.CoverImage, err = checkPath(h.policy, pandoc.NormalizePath(opts.CoverImage), sandbox.AccessRead); err != nil {
+			return nil, err
+		}
+	}
+	if req.outputFile != "" {
+		if c.outputFile, err = checkPath(h.policy, pandoc.NormalizePath(req.outputFile), sandbox.AccessWrite); err != nil {
+			return nil, err
+		}
+	}
+	opts.ResourcePath = resourcePath(h.policy, append(append([]string{}, c.inputFiles...), opts.CoverImage)...)
+
+	// Infer formats that were not given from file extensions and content
+	if c.inputFormat == "" {
+		switch {
+		case req.binary != nil:
+			c.inputFormat, c.inputFormatSource = pandoc.InferContentFormat(req.binary.data, req.binary.name, req.binary.mimeType)
+		case len(c.inputFiles) > 0:
+			c.inputFormat, c.inputFormatSource = pandoc.InferInputFormat(c.inputFiles[0], "")
+		default:
+			c.inputFormat, c.inputFormatSource = pandoc.InferInputFormat("", req.contents)
+		}
+		logger.Trace("Входной формат определен автоматически: %s (%s)", c.inputFormat, c.inputFormatSource)
+	}
+	if c.outputFormat == "" {
+		c.outputFormat, c.outputFormatSource = pandoc.InferOutputFormat(c.outputFile)
+		logger.Trace("Выходной формат определен автоматически: %s (%s)", c.outputFormat, c.outputFormatSource)
+	}
+
+	// Check if PDF is used as input format (not supported by Pandoc)
+	if pandoc.LookupFormat(c.inputFormat).Name == "pdf" {
+		logger.Error("PDF не поддерживается как входной формат для Pandoc")
+		return nil, &pandoc.FormatError{Input: c.inputFormat, Output: c.outputFormat, Reason: "PDF is not supported as input format, Pandoc can convert to PDF but not from PDF"}
+	}
+	if !h.converter.ValidateInputFormat(c.inputFormat) || !h.converter.ValidateOutputFormat(c.outputFormat) {
+		logger.Error("Неподдерживаемый формат: input=%s, output=%s", c.inputFormat, c.outputFormat)
+		return nil, &pandoc.FormatError{Input: c.inputFormat, Output: c.outputFormat}
+	}
+	return c, nil
+}
+
+// formats returns the formats of the conversion and how they were found, as
+// reported in tool results
+func (c *conversion) formats() map[string]any {
+	return map[string]any{
+		"input_format":         c.inputFormat,
+		"input_format_source":  c.inputFormatSource,
+		"output_format":        c.outputFormat,
+		"output_format_source": c.outputFormatSource,
+	}
+}
@@ -0,0 +1,388 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/logging"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/sandbox"
+)
+
+// linkRewriteFilter is the built-in filter pointing links between source
+// documents at the converted files
+const linkRewriteFilter = "relative-link-rewrite"
+
+// defaultDirectoryInclude selects the documents of a directory conversion
+var defaultDirectoryInclude = []string{"**/*.md", "**/*.markdown"}
+
+// referencePatterns find the files a markdown or HTML document links to:
+// inline links and images, reference definitions and src/href attributes
+var referencePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\]\(\s*<?([^)\s>]+)>?(?:\s+["'(][^)]*)?\)`),
+	regexp.MustCompile(`(?m)^\s{0,3}\[[^\]]+\]:\s*<?([^\s>]+)>?`),
+	regexp.MustCompile(`(?i)\b(?:src|href)\s*=\s*["']([^"']+)["']`),
+}
+
+// AssetCopy is the outcome of copying one file referenced by the documents
+type AssetCopy struct {
+	Source     string `json:"source"`
+	OutputFile string `json:"output_file"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+// DirectoryResult is the outcome of a directory conversion: the converted
+// documents as in a batch and the copied assets
+type DirectoryResult struct {
+	SourceDir string `json:"source_dir"`
+	OutputDir string `json:"output_dir"`
+	*BatchResult
+	Assets []AssetCopy `json:"assets"`
+}
+
+// ConvertDirectory converts the documents of a directory tree into a mirror
+// tree, copying the files they reference and rewriting the links between
+// them to the converted files
+func (h *Handler) ConvertDirectory(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	logger := logging.GetGlobalLogger()
+	logger.DetailedInfo("Начало обработки запроса convert_directory")
+	ctx = pandoc.WithClient(ctx, sessionKey(ctx))
+	args := req.Params.Arguments
+
+	opts, err := parseOptions(args)
+	if err != nil {
+		logger.Error("Некорректные параметры конвертации: %v", err)
+		return errorResult(err)
+	}
+	parallel, err := parallelArg(args)
+	if err != nil {
+		logger.Error("Некорректный параметр max_parallel: %v", err)
+		return errorResult(err)
+	}
+	sourceDir, outputDir, err := directoryArgs(h.policy, args)
+	if err != nil {
+		logger.Error("Некорректные каталоги: %v", err)
+		return errorResult(err)
+	}
+	include, err := stringListArg(args, "include")
+	if err != nil {
+		return errorResult(err)
+	}
+	if len(include) == 0 {
+		include = defaultDirectoryInclude
+	}
+	inputFormat, err := stringArg(args, "input_format")
+	if err != nil {
+		return errorResult(err)
+	}
+	outputFormat, err := stringArg(args, "output_format")
+	if err != nil {
+		return errorResult(err)
+	}
+	if outputFormat == "" {
+		outputFormat = "html"
+	}
+	outputExt, err := stringArg(args, "output_extension")
+	if err != nil {
+		return errorResult(err)
+	}
+	if outputExt == "" {
+		outputExt = pandoc.FileExtension(outputFormat)
+	}
+	outputExt = "." + strings.TrimPrefix(outputExt, ".")
+
+	documents, err := findDocuments(sourceDir, outputDir, include)
+	if err != nil {
+		logger.Error("Не удалось обойти каталог %s: %v", sourceDir, err)
+		return errorResult(err)
+	}
+	if len(documents) == 0 {
+		return errorResult(&pandoc.ArgumentError{Argument: "include", Reason: fmt.Sprintf("no documents in %s match %s", sourceDir, strings.Join(include, ", "))})
+	}
+	if len(documents) > maxBatchItems {
+		return errorResult(&pandoc.ArgumentError{Argument: "source_dir", Reason: fmt.Sprintf("contains %d documents, at most %d are allowed", len(documents), maxBatchItems)})
+	}
+
+	// Every document is converted with the link rewrite filter, told which
+	// extensions are converted and what they become
+	jobArgs := mergeArgs(args, map[string]any{
+		"filters":  linkRewriteFilters(opts.Filters),
+		"metadata": linkRewriteMetadata(opts.Metadata, documents, outputExt),
+	})
+	jobs := make([]batchJob, 0, len(documents))
+	for _, rel := range documents {
+		jobs = append(jobs, batchJob{
+			inputFile:    filepath.Join(sourceDir, rel),
+			outputFile:   filepath.Join(outputDir, strings.TrimSuffix(rel, filepath.Ext(rel))+outputExt),
+			inputFormat:  inputFormat,
+			outputFormat: outputFormat,
+			args:         jobArgs,
+		})
+	}
+	failDuplicateOutputs(jobs)
+
+	logger.Info("Конвертация каталога %s → %s: %d документов", sourceDir, outputDir, len(jobs))
+	result := &DirectoryResult{SourceDir: sourceDir, OutputDir: outputDir}
+	result.BatchResult = h.runBatch(ctx, jobs, parallel)
+	// Only the assets of documents that were converted are copied
+	var converted []string
+	for i, item := range result.Items {
+		if item.Success {
+			converted = append(converted, documents[i])
+		}
+	}
+	result.Assets = copyAssets(h.policy, sourceDir, outputDir, documents, converted, opts.OnExists)
+	logger.Info("Конвертация каталога завершена: успешно %d из %d, скопировано файлов %d",
+		result.Succeeded, result.Total, len(result.Assets))
+
+	jsonData, _ := json.Marshal(result)
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+// directoryArgs returns the source_dir and output_dir arguments, checked
+// against the sandbox policy
+func directoryArgs(policy *sandbox.Policy, args map[string]any) (string, string, error) {
+	sourceDir, err := stringArg(args, "source_dir")
+	if err != nil {
+		return "", "", err
+	}
+	if sourceDir == "" {
+		return "", "", &pandoc.ArgumentError{Argument: "source_dir", Reason: "required"}
+	}
+	outputDir, err := stringArg(args, "output_dir")
+	if err != nil {
+		return "", "", err
+	}
+	if outputDir == "" {
+		return "", "", &pandoc.ArgumentError{Argument: "output_dir", Reason: "required"}
+	}
+
+	if sourceDir, err = checkPath(policy, pandoc.NormalizePath(sourceDir), sandbox.AccessRead); err != nil {
+		return "", "", err
+	}
+	if info, err := os.Stat(sourceDir); err != nil || !info.IsDir() {
+		return "", "", &pandoc.InputNotFoundError{Path: sourceDir}
+	}
+	if outputDir, err = checkPath(policy, pandoc.NormalizePath(outputDir), sandbox.AccessWrite); err != nil {
+		return "", "", err
+	}
+	if outputDir == sourceDir {
+		return "", "", &pandoc.ArgumentError{Argument: "output_dir", Reason: "must differ from source_dir"}
+	}
+	return sourceDir, outputDir, nil
+}
+
+// findDocuments returns the paths, relative to sourceDir, of the files
+// matching one of the include patterns. Hidden files and directories and the
+// output directory are skipped.
+func findDocuments(sourceDir, outputDir string, include []string) ([]string, error) {
+	patterns := make([][]string, 0, len(include))
+	for _, pattern := range include {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, &pandoc.ArgumentError{Argument: "include", Reason: fmt.Sprintf("invalid pattern %s: %v", pattern, err)}
+		}
+		patterns = append(patterns, strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/"))
+	}
+
+	var documents []string
+	err := filepath.WalkDir(sourceDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if file == sourceDir {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") || file == outputDir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(sourceDir, file)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		for _, pattern := range patterns {
+			if matchGlob(pattern, parts) {
+				documents = append(documents, rel)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", sourceDir, err)
+	}
+	return documents, nil
+}
+
+// linkRewriteFilters adds the link rewrite filter after the requested ones,
+// as a filters argument
+func linkRewriteFilters(filters []string) []any {
+	names := appendFilter(filters, linkRewriteFilter)
+	list := make([]any, len(names))
+	for i, name := range names {
+		list[i] = name
+	}
+	return list
+}
+
+// appendFilter moves or adds the filter name to the end of filters
+func appendFilter(filters []string, name string) []string {
+	list := make([]string, 0, len(filters)+1)
+	for _, filter := range filters {
+		if filter != name {
+			list = append(list, filter)
+		}
+	}
+	return append(list, name)
+}
+
+// linkRewriteMetadata returns the requested metadata with the fields that
+// tell the link rewrite filter the extensions of the documents and their
+// output extension
+func linkRewriteMetadata(metadata map[string]string, documents []string, outputExt string) map[string]any {
+	result := make(map[string]any, len(metadata)+2)
+	for key, value := range metadata {
+		result[key] = value
+	}
+
+	seen := make(map[string]bool)
+	var sources []string
+	for _, rel := range documents {
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(rel), "."))
+		if ext != "" && !seen[ext] {
+			seen[ext] = true
+			sources = append(sources, ext)
+		}
+	}
+	sort.Strings(sources)
+
+	result["relative-link-sources"] = strings.Join(sources, ", ")
+	result["relative-link-extension"] = strings.TrimPrefix(outputExt, ".")
+	return result
+}
+
+// copyAssets copies the files inside sourceDir that the converted documents
+// reference, other than documents themselves, to the same relative paths
+// under outputDir, handling existing files by the onExists policy. Assets
+// keep their names, since the documents refer to them by name: under the
+// rename policy an existing asset is kept instead of copied.
+func copyAssets(policy *sandbox.Policy, sourceDir, outputDir string, documents, converted []string, onExists string) []AssetCopy {
+	isDocument := make(map[string]bool, len(documents))
+	for _, rel := range documents {
+		isDocument[rel] = true
+	}
+
+	assets := make(map[string]bool)
+	for _, rel := range converted {
+		for _, asset := range references(sourceDir, rel) {
+			if !isDocument[asset] {
+				assets[asset] = true
+			}
+		}
+	}
+	sorted := make([]string, 0, len(assets))
+	for asset := range assets {
+		sorted = append(sorted, asset)
+	}
+	sort.Strings(sorted)
+
+	keep := onExists == pandoc.OnExistsRename
+	if keep {
+		onExists = pandoc.OnExistsFail
+	}
+
+	logger := logging.GetGlobalLogger()
+	copies := make([]AssetCopy, 0, len(sorted))
+	for _, rel := range sorted {
+		c := AssetCopy{Source: filepath.Join(sourceDir, rel), OutputFile: filepath.Join(outputDir, rel)}
+		written, err := copyAsset(policy, c.Source, c.OutputFile, onExists)
+		var exists *pandoc.OutputExistsError
+		if keep && errors.As(err, &exists) {
+			c.Success, c.Message = true, "kept the existing file"
+			logger.FileOperation("COPY_ASSET", c.OutputFile, true, "Файл уже существует, сохранён")
+		} else if err != nil {
+			c.Error, c.Message = pandoc.ErrorKind(err), err.Error()
+			logger.FileOperation("COPY_ASSET", c.Source, false, err.Error())
+		} else {
+			c.Success, c.OutputFile = true, written
+			logger.FileOperation("COPY_ASSET", c.OutputFile, true, "")
+		}
+		copies = append(copies, c)
+	}
+	return copies
+}
+
+// references returns the existing files inside sourceDir that the document
+// rel links to, relative to sourceDir. Absolute URLs and paths are ignored.
+func references(sourceDir, rel string) []string {
+	data, err := os.ReadFile(filepath.Join(sourceDir, rel))
+	if err != nil {
+		return nil
+	}
+
+	var found []string
+	for _, pattern := range referencePatterns {
+		for _, m := range pattern.FindAllStringSubmatch(string(data), -1) {
+			target := m[1]
+			if i := strings.IndexAny(target, "#?"); i >= 0 {
+				target = target[:i]
+			}
+			if target == "" || strings.HasPrefix(target, "/") || strings.Contains(target, ":") {
+				continue
+			}
+			if unescaped, err := url.PathUnescape(target); err == nil {
+				target = unescaped
+			}
+
+			file := filepath.Join(sourceDir, filepath.Dir(rel), filepath.FromSlash(target))
+			if !isWithin(sourceDir, file) {
+				continue
+			}
+			if info, err := os.Stat(file); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			if assetRel, err := filepath.Rel(sourceDir, file); err == nil {
+				found = append(found, assetRel)
+			}
+		}
+	}
+	return found
+}
+
+// copyAsset copies source to target after checking both against policy and
+// returns the path actually written under the onExists policy
+func copyAsset(policy *sandbox.Policy, source, target, onExists string) (string, error) {
+	source, err := checkPath(policy, source, sandbox.AccessRead)
+	if err != nil {
+		return "", err
+	}
+	if target, err = checkPath(policy, target, sandbox.AccessWrite); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(source)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", &pandoc.InputNotFoundError{Path: source}
+		}
+		return "", fmt.Errorf("failed to read %s: %v", source, err)
+	}
+	return pandoc.WriteOutputFile(data, target, onExists)
+}
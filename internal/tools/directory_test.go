@@ -0,0 +1,36 @@
+package tools
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/sandbox"
+)
+
+func TestCopyAssetsKeepsNames(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir, outputDir := filepath.Join(dir, "src"), filepath.Join(dir, "out")
+	writeFile(t, filepath.Join(sourceDir, "doc.md"), "![logo](img/logo.png)\n")
+	writeFile(t, filepath.Join(sourceDir, "img", "logo.png"), "new")
+	writeFile(t, filepath.Join(outputDir, "img", "logo.png"), "old")
+	policy := sandbox.New([]string{dir}, nil, nil, nil)
+	docs := []string{"doc.md"}
+
+	for _, tt := range []struct{ onExists, want string }{
+		{pandoc.OnExistsRename, "old"},
+		{pandoc.OnExistsOverwrite, "new"},
+	} {
+		copies := copyAssets(policy, sourceDir, outputDir, docs, docs, tt.onExists)
+		target := filepath.Join(outputDir, "img", "logo.png")
+		if len(copies) != 1 || !copies[0].Success || copies[0].OutputFile != target {
+			t.Fatalf("%s: copies = %+v, want logo.png copied to %s", tt.onExists, copies, target)
+		}
+		if got := readFile(t, target); got != tt.want {
+			t.Errorf("%s: logo.png = %q, want %q", tt.onExists, got, tt.want)
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(outputDir, "img", "logo-*")); len(matches) != 0 {
+		t.Errorf("renamed copies written: %v", matches)
+	}
+}
@@ -0,0 +1,40 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/logging"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/sandbox"
+)
+
+// errorResult reports err as a tool error result, with IsError set, whose
+// text is a JSON object the client can act on: the error kind, the message,
+// a hint for fixing the request and the details of typed errors
+func errorResult(err error) (*mcp.CallToolResult, error) {
+	jsonData, _ := json.Marshal(errorData(err))
+	return mcp.NewToolResultError(string(jsonData)), nil
+}
+
+// errorData describes err for the client, as in errorResult
+func errorData(err error) map[string]any {
+	var pathErr *sandbox.PathError
+	if errors.As(err, &pathErr) {
+		logging.GetGlobalLogger().FileOperation("SANDBOX", pathErr.Path, false, pathErr.Error())
+	}
+
+	data := map[string]any{
+		"error":   pandoc.ErrorKind(err),
+		"message": err.Error(),
+	}
+	if hint := pandoc.ErrorHint(err); hint != "" {
+		data["hint"] = hint
+	}
+	var kindErr pandoc.KindError
+	if errors.As(err, &kindErr) {
+		data["details"] = kindErr
+	}
+	return data
+}
@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/logging"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+)
+
+// FormatsHandler serves the list_formats tool
+type FormatsHandler struct {
+	capabilities func() *pandoc.Capabilities
+}
+
+// NewFormatsHandler creates the list_formats handler; capabilities is called
+// on every request, so a pandoc replaced at runtime is reported as it is
+func NewFormatsHandler(capabilities func() *pandoc.Capabilities) *FormatsHandler {
+	return &FormatsHandler{capabilities: capabilities}
+}
+
+// ListFormats lists the input and output formats and the extensions the
+// installed pandoc supports
+func (h *FormatsHandler) ListFormats(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	logger := logging.GetGlobalLogger()
+	logger.DetailedInfo("Начало обработки запроса list_formats")
+
+	capabilities := h.capabilities()
+	outputs := capabilities.OutputNames()
+	needsOutputFile := []string{}
+	for _, format := range outputs {
+		if pandoc.NeedsOutputFile(format) {
+			needsOutputFile = append(needsOutputFile, format)
+		}
+	}
+	extensions := capabilities.Extensions
+	if extensions == nil {
+		extensions = []string{}
+	}
+	logger.Trace("Форматов: %d входных, %d выходных", len(capabilities.InputFormats), len(capabilities.OutputFormats))
+
+	data := map[string]any{
+		"input_formats":            capabilities.InputNames(),
+		"output_formats":           outputs,
+		"output_file_required_for": needsOutputFile,
+		"extensions":               extensions,
+	}
+	jsonData, _ := json.Marshal(data)
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
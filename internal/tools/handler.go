@@ -3,6 +3,7 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,20 +11,30 @@ import (
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/snowwhiteai/mcp-pandoc-go/internal/logging"
 	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/sandbox"
 )
 
-// ConvertContentsHandler handles document conversion requests
-func ConvertContentsHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+// Handler serves the conversion tools. The converter and the sandbox policy
+// are injected, so the handlers can run against pandoctest.Fake instead of
+// the pandoc executable, with roots of the caller's choosing.
+type Handler struct {
+	converter pandoc.Converter
+	policy    *sandbox.Policy
+}
+
+// NewHandler creates a handler converting with converter and checking the
+// paths of every request against policy, both shared by all requests
+func NewHandler(converter pandoc.Converter, policy *sandbox.Policy) *Handler {
+	return &Handler{converter: converter, policy: policy}
+}
+
+// ConvertContents handles document conversion requests
+func (h *Handler) ConvertContents(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	logger := logging.GetGlobalLogger()
 	logger.DetailedInfo("Начало обработки запроса convert_contents")
-
-	// Create converter
-	converter, err := pandoc.NewConverter()
-	if err != nil {
-		logger.Error("Не удалось инициализировать Pandoc: %v", err)
-		return nil, fmt.Errorf("Failed to initialize Pandoc: %v", err)
-	}
-	logger.Trace("Конвертер Pandoc успешно инициализирован")
+	converter := h.converter
+	// Conversions of different sessions share the scheduler's queue fairly
+	ctx = pandoc.WithClient(ctx, sessionKey(ctx))
 
 	// Extract parameters
 	args := req.Params.Arguments
@@ -33,6 +44,18 @@ func ConvertContentsHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.
 		contents, _ = val.(string)
 		logger.Trace("Получены входные данные в виде строки длиной %d символов", len(contents))
 	}
+	binary, err := parseBinaryInput(args)
+	if err != nil {
+		logger.Error("Некорректные двоичные входные данные: %v", err)
+		return errorResult(err)
+	}
+	if binary != nil {
+		if contents != "" {
+			logger.Error("Указаны одновременно contents и двоичные входные данные")
+			return errorResult(&pandoc.ArgumentError{Argument: "contents", Reason: "only one of contents, contents_base64 and contents_resource may be provided"})
+		}
+		logger.Trace("Получены двоичные входные данные размером %d байт", len(binary.data))
+	}
 	if val, ok := args["input_file"]; ok {
 		inputFile, _ = val.(string)
 		// Normalize input file path
@@ -42,13 +65,9 @@ func ConvertContentsHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.
 	}
 	if val, ok := args["input_format"]; ok {
 		inputFormat, _ = val.(string)
-	} else {
-		inputFormat = "markdown"
 	}
 	if val, ok := args["output_format"]; ok {
 		outputFormat, _ = val.(string)
-	} else {
-		outputFormat = "markdown"
 	}
 	if val, ok := args["output_file"]; ok {
 		outputFile, _ = val.(string)
@@ -58,80 +77,131 @@ func ConvertContentsHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.
 		logger.FileOperation("NORMALIZE", outputFile, true, fmt.Sprintf("Было: %s", prevPath))
 	}
 
-	logger.DetailedInfo("Параметры конвертации: input_format=%s, output_format=%s", inputFormat, outputFormat)
-	if inputFile != "" {
-		logger.FileOperation("READ_INPUT", inputFile, true, "")
+	// Parse conversion options
+	opts, err := parseOptions(args)
+	if err != nil {
+		logger.Error("Некорректные параметры конвертации: %v", err)
+		return errorResult(err)
 	}
-	if outputFile != "" {
-		logger.FileOperation("PREPARE_OUTPUT", outputFile, true, "")
+	requestedMode, err := stringArg(args, "output_mode")
+	if err != nil {
+		logger.Error("Некорректный режим вывода: %v", err)
+		return errorResult(err)
 	}
 
 	// Check required parameters
-	if contents == "" && inputFile == "" {
-		logger.Error("Не указаны входные данные (contents или input_file)")
-		return nil, fmt.Errorf("Either contents or input_file must be provided")
+	if contents == "" && binary == nil && inputFile == "" {
+		logger.Error("Не указаны входные данные (contents, contents_base64, contents_resource или input_file)")
+		return errorResult(&pandoc.ArgumentError{Argument: "contents", Reason: "one of contents, contents_base64, contents_resource or input_file must be provided"})
 	}
 
-	// Check that formats are valid
-	if !converter.ValidateFormat(inputFormat) || !converter.ValidateFormat(outputFormat) {
-		logger.Error("Неподдерживаемый формат: input=%s, output=%s", inputFormat, outputFormat)
-		return nil, fmt.Errorf("Unsupported format(s): input=%s, output=%s", inputFormat, outputFormat)
+	// Check client-supplied paths against the sandbox policy and settle the formats
+	request := conversionRequest{
+		contents:     contents,
+		binary:       binary,
+		inputFormat:  inputFormat,
+		outputFormat: outputFormat,
+		outputFile:   outputFile,
 	}
-
-	// Check if PDF is used as input format (not supported by Pandoc)
-	if inputFormat == "pdf" {
-		logger.Error("PDF не поддерживается как входной формат для Pandoc")
-		return nil, fmt.Errorf("PDF is not supported as input format, Pandoc can convert to PDF but not from PDF")
+	if inputFile != "" {
+		request.inputFiles = []string{inputFile}
+	}
+	resolved, err := h.resolveConversion(request, &opts)
+	if err != nil {
+		return errorResult(err)
+	}
+	if inputFile != "" {
+		inputFile = resolved.inputFiles[0]
 	}
+	outputFile = resolved.outputFile
+	inputFormat, outputFormat = resolved.inputFormat, resolved.outputFormat
+	formats := resolved.formats()
 
-	// Check if output file is needed
-	needsOutputFile := outputFormat == "pdf" || outputFormat == "docx" ||
-		outputFormat == "epub" || outputFormat == "latex" || outputFormat == "rst"
+	logger.DetailedInfo("Параметры конвертации: input_format=%s, output_format=%s", inputFormat, outputFormat)
+	if inputFile != "" {
+		logger.FileOperation("READ_INPUT", inputFile, true, "")
+	}
+	if outputFile != "" {
+		logger.FileOperation("PREPARE_OUTPUT", outputFile, true, "")
+	}
 
-	if needsOutputFile && outputFile == "" {
-		logger.Error("Не указан выходной файл для формата %s", outputFormat)
-		return nil, fmt.Errorf("Output file is required for %s format", outputFormat)
+	// Decide whether the result is written to output_file, returned inline or both
+	outputMode, err := resolveOutputMode(requestedMode, outputFile, outputFormat)
+	if err != nil {
+		logger.Error("Некорректный режим вывода: %v", err)
+		return errorResult(err)
+	}
+	targetFile := ""
+	if outputMode == OutputModeFile || outputMode == OutputModeBoth {
+		targetFile = outputFile
 	}
+	logger.Trace("Режим вывода: %s", outputMode)
 
 	// Check if input file exists
 	if inputFile != "" {
 		if _, err := os.Stat(inputFile); os.IsNotExist(err) {
 			logger.FileOperation("CHECK", inputFile, false, "Файл не существует")
-			return nil, fmt.Errorf("Input file not found: %s", inputFile)
+			return errorResult(&pandoc.InputNotFoundError{Path: inputFile})
 		}
 		logger.FileOperation("CHECK", inputFile, true, "Файл существует")
 	}
 
 	// Create output directory if it doesn't exist
-	if outputFile != "" {
-		dir := filepath.Dir(outputFile)
+	if targetFile != "" {
+		dir := filepath.Dir(targetFile)
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			logger.FileOperation("CREATE_DIR", dir, false, fmt.Sprintf("Ошибка: %v", err))
-			return nil, fmt.Errorf("Failed to create output directory: %v", err)
+			return errorResult(fmt.Errorf("Failed to create output directory: %v", err))
 		}
 		logger.FileOperation("CREATE_DIR", dir, true, "Директория создана или уже существует")
 	}
 
 	var result string
+	var converted *pandoc.Result
 	var convertErr error
 
 	// Run conversion based on input parameters
-	if contents != "" {
-		if outputFile != "" {
+	if binary != nil {
+		// Convert content received over the protocol
+		logger.Trace("Начинаем конвертацию двоичных данных: %s → %s", inputFormat, outputFormat)
+		converted, convertErr = converter.ConvertBytes(ctx, binary.data, inputFormat, outputFormat, targetFile, opts)
+		if convertErr == nil {
+			if targetFile != "" {
+				logger.ConversionOperation(inputFormat, outputFormat, fmt.Sprintf("Данные → %s", converted.OutputFile), true)
+				result = fmt.Sprintf("Successfully converted %s to %s file: %s", inputFormat, outputFormat, converted.OutputFile)
+			} else {
+				result = string(converted.Output)
+				logger.ConversionOperation(inputFormat, outputFormat, "Данные → Строка", true)
+			}
+		} else {
+			logger.ConversionOperation(inputFormat, outputFormat, fmt.Sprintf("Ошибка: %v", convertErr), false)
+		}
+	} else if contents != "" {
+		if targetFile != "" {
 			// Convert string to file
 			logger.Trace("Начинаем конвертацию строки в файл: %s → %s", inputFormat, outputFormat)
-			convertErr = converter.ConvertStringToFile(contents, inputFormat, outputFormat, outputFile)
+			converted, convertErr = converter.ConvertStringToFile(ctx, contents, inputFormat, outputFormat, targetFile, opts)
+			if convertErr == nil {
+				logger.ConversionOperation(inputFormat, outputFormat, fmt.Sprintf("Строка → %s", converted.OutputFile), true)
+				result = fmt.Sprintf("Successfully converted %s to %s file: %s", inputFormat, outputFormat, converted.OutputFile)
+			} else {
+				logger.ConversionOperation(inputFormat, outputFormat, fmt.Sprintf("Ошибка: %v", convertErr), false)
+			}
+		} else if pandoc.NeedsOutputFile(outputFormat) {
+			// Convert string to binary content returned inline
+			logger.Trace("Начинаем конвертацию строки в двоичные данные: %s → %s", inputFormat, outputFormat)
+			converted, convertErr = converter.ConvertStringToFile(ctx, contents, inputFormat, outputFormat, "", opts)
 			if convertErr == nil {
-				logger.ConversionOperation(inputFormat, outputFormat, fmt.Sprintf("Строка → %s", outputFile), true)
-				result = fmt.Sprintf("Successfully converted %s to %s file: %s", inputFormat, outputFormat, outputFile)
+				logger.ConversionOperation(inputFormat, outputFormat, "Строка → Данные", true)
 			} else {
 				logger.ConversionOperation(inputFormat, outputFormat, fmt.Sprintf("Ошибка: %v", convertErr), false)
 			}
 		} else {
 			// Convert string to string
 			logger.Trace("Начинаем конвертацию строки в строку: %s → %s", inputFormat, outputFormat)
-			result, convertErr = converter.ConvertString(contents, inputFormat, outputFormat)
+			converted, convertErr = converter.ConvertString(ctx, contents, inputFormat, outputFormat, opts)
 			if convertErr == nil {
+				result = string(converted.Output)
 				logger.ConversionOperation(inputFormat, outputFormat, "Строка → Строка", true)
 			} else {
 				logger.ConversionOperation(inputFormat, outputFormat, fmt.Sprintf("Ошибка: %v", convertErr), false)
@@ -140,26 +210,15 @@ func ConvertContentsHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.
 	} else if inputFile != "" {
 		// Convert file
 		logger.Trace("Начинаем конвертацию файла: %s (%s) → %s", inputFile, inputFormat, outputFormat)
-		convertErr = converter.ConvertFile(inputFile, inputFormat, outputFormat, outputFile)
+		converted, convertErr = converter.ConvertFile(ctx, inputFile, inputFormat, outputFormat, targetFile, opts)
 		if convertErr == nil {
-			if outputFile != "" {
-				logger.ConversionOperation(inputFormat, outputFormat, fmt.Sprintf("%s → %s", inputFile, outputFile), true)
-				result = fmt.Sprintf("Successfully converted %s to %s file: %s", inputFile, outputFormat, outputFile)
+			if targetFile != "" {
+				logger.ConversionOperation(inputFormat, outputFormat, fmt.Sprintf("%s → %s", inputFile, converted.OutputFile), true)
+				result = fmt.Sprintf("Successfully converted %s to %s file: %s", inputFile, outputFormat, converted.OutputFile)
 			} else {
-				// Read temporary file if it was created
-				tempFiles, _ := os.ReadDir(os.TempDir())
-				for _, file := range tempFiles {
-					if file.Name() == fmt.Sprintf("pandoc-output-*.%s", outputFormat) {
-						content, err := os.ReadFile(fmt.Sprintf("%s/%s", os.TempDir(), file.Name()))
-						if err == nil {
-							result = string(content)
-							logger.ConversionOperation(inputFormat, outputFormat, fmt.Sprintf("%s → временный файл", inputFile), true)
-						} else {
-							logger.FileOperation("READ", fmt.Sprintf("%s/%s", os.TempDir(), file.Name()), false, fmt.Sprintf("Ошибка: %v", err))
-						}
-						break
-					}
-				}
+				// Converted content is returned directly for text formats
+				result = string(converted.Output)
+				logger.ConversionOperation(inputFormat, outputFormat, fmt.Sprintf("%s → Строка", inputFile), true)
 			}
 		} else {
 			logger.ConversionOperation(inputFormat, outputFormat, fmt.Sprintf("Ошибка: %v", convertErr), false)
@@ -167,25 +226,94 @@ func ConvertContentsHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.
 	}
 
 	if convertErr != nil {
-		logger.Error("Ошибка конвертации: %v", convertErr)
-		return nil, fmt.Errorf("Conversion failed: %v", convertErr)
+		var timeoutErr *pandoc.TimeoutError
+		var existsErr *pandoc.OutputExistsError
+		var busyErr *pandoc.BusyError
+		switch {
+		case errors.As(convertErr, &busyErr):
+			logger.Error("Очередь конвертаций (%s) переполнена: %d в ожидании", busyErr.Lane, busyErr.Queued)
+		case errors.As(convertErr, &timeoutErr):
+			logger.Error("Превышено время конвертации в %s: %s", timeoutErr.Format, timeoutErr.Timeout)
+		case errors.As(convertErr, &existsErr):
+			logger.FileOperation("WRITE_OUTPUT", existsErr.Path, false, "Файл уже существует")
+		case ctx.Err() != nil:
+			logger.Error("Конвертация отменена клиентом: %v", ctx.Err())
+		default:
+			logger.Error("Ошибка конвертации (%s): %v", pandoc.ErrorKind(convertErr), convertErr)
+		}
+		var pandocErr *pandoc.PandocError
+		if errors.As(convertErr, &pandocErr) {
+			for _, w := range pandocErr.Warnings {
+				logger.Warn("Предупреждение Pandoc (%s): %s", w.Type, w.Message)
+			}
+		}
+		return errorResult(convertErr)
 	}
 
 	logger.DetailedInfo("Конвертация успешно завершена")
+	if converted.Cached {
+		logger.Trace("Результат взят из кэша")
+		formats["cached"] = true
+	}
+	for _, w := range converted.Warnings {
+		logger.Warn("Предупреждение Pandoc (%s): %s", w.Type, w.Message)
+	}
+
+	// Return result depending on output mode
+	switch outputMode {
+	case OutputModeInline, OutputModeBoth:
+		return inlineResult(outputMode, converted, outputFormat, inputFile, outputFile, opts.OnExists, formats)
+	}
 
-	// Return result depending on output type
-	if needsOutputFile {
+	if pandoc.NeedsOutputFile(outputFormat) {
 		// For binary formats return path to file
-		data := map[string]string{
-			"output_file": outputFile,
+		data := map[string]any{
+			"output_file": converted.OutputFile,
 			"message":     result,
 		}
+		if converted.OutputFile != outputFile {
+			data["requested_output_file"] = outputFile
+		}
+		if len(converted.Warnings) > 0 {
+			data["warnings"] = converted.Warnings
+		}
+		for key, value := range formats {
+			data[key] = value
+		}
 		jsonData, _ := json.Marshal(data)
-		logger.Trace("Возвращаем результат конвертации (путь к файлу): %s", outputFile)
-		return mcp.NewToolResultText(string(jsonData)), nil
+		logger.Trace("Возвращаем результат конвертации (путь к файлу): %s", converted.OutputFile)
+		return withFormats(mcp.NewToolResultText(string(jsonData)), formats), nil
 	} else {
 		// For text formats return content
 		logger.Trace("Возвращаем результат конвертации (текстовое содержимое)")
-		return mcp.NewToolResultText(result), nil
+		return withWarnings(withFormats(mcp.NewToolResultText(result), formats), converted.Warnings), nil
+	}
+}
+
+// withWarnings reports pandoc warnings, such as unresolved citations, in the
+// result metadata and as a separate JSON content item after the document
+func withWarnings(result *mcp.CallToolResult, warnings []pandoc.Warning) *mcp.CallToolResult {
+	if len(warnings) == 0 {
+		return result
+	}
+	if result.Meta == nil {
+		result.Meta = make(map[string]any)
+	}
+	result.Meta["warnings"] = warnings
+
+	jsonData, _ := json.Marshal(map[string]any{"warnings": warnings})
+	result.Content = append(result.Content, mcp.NewTextContent(string(jsonData)))
+	return result
+}
+
+// withFormats reports the formats used for the conversion, and how they were
+// determined, in the result metadata
+func withFormats(result *mcp.CallToolResult, formats map[string]any) *mcp.CallToolResult {
+	if result.Meta == nil {
+		result.Meta = make(map[string]any)
+	}
+	for key, value := range formats {
+		result.Meta[key] = value
 	}
+	return result
 }
@@ -0,0 +1,572 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/logging"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc/pandoctest"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/sandbox"
+)
+
+// fakeOutput is what the default fake converts every document to
+const fakeOutput = "<p>converted</p>"
+
+// handlerCase is one convert_contents request against a fake converter, run
+// with the sandbox roots limited to dir
+type handlerCase struct {
+	name string
+	// fake answers the conversion; nil uses pandoctest.NewFake(fakeOutput)
+	fake *pandoctest.Fake
+	// setup creates the files the request refers to
+	setup func(t *testing.T, dir string)
+	args  func(dir string) map[string]any
+	// env sets environment variables for the request
+	env map[string]string
+	// cancel runs the request with an already cancelled context
+	cancel bool
+	// wantError is the error kind of a failed request, empty for success
+	wantError string
+	check     func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake)
+}
+
+// callConvertContents runs convert_contents with args
+func callConvertContents(ctx context.Context, h *Handler, args map[string]any) (*mcp.CallToolResult, error) {
+	var req mcp.CallToolRequest
+	req.Params.Name = "convert_contents"
+	req.Params.Arguments = args
+	return h.ConvertContents(ctx, req)
+}
+
+// resultText returns the text of the first content item of result
+func resultText(t *testing.T, result *mcp.CallToolResult) string {
+	t.Helper()
+	if len(result.Content) == 0 {
+		t.Fatal("result has no content")
+	}
+	text, ok := result.Content[0].(mcp.TextContent)
+	if !ok {
+		t.Fatalf("first content item is %T, want text", result.Content[0])
+	}
+	return text.Text
+}
+
+// resultJSON decodes the first content item of result as a JSON object
+func resultJSON(t *testing.T, result *mcp.CallToolResult) map[string]any {
+	t.Helper()
+	var data map[string]any
+	if err := json.Unmarshal([]byte(resultText(t, result)), &data); err != nil {
+		t.Fatalf("result is not JSON: %v\n%s", err, resultText(t, result))
+	}
+	return data
+}
+
+// writeFile creates path with content
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFile returns the content of path
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// onlyCall returns the single conversion the fake was asked for
+func onlyCall(t *testing.T, fake *pandoctest.Fake) pandoctest.Call {
+	t.Helper()
+	calls := fake.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("converter called %d times, want once", len(calls))
+	}
+	return calls[0]
+}
+
+// existingOutput creates out.html with old content in dir
+func existingOutput(t *testing.T, dir string) {
+	t.Helper()
+	writeFile(t, filepath.Join(dir, "out.html"), "old")
+}
+
+// errorKindCase is a conversion the fake fails with err, which must reach
+// the client as an error result of kind want
+func errorKindCase(name string, err error, want string) handlerCase {
+	return handlerCase{
+		name:      name,
+		fake:      &pandoctest.Fake{Err: err},
+		args:      func(dir string) map[string]any { return map[string]any{"contents": "# Title", "output_format": "html"} },
+		wantError: want,
+		check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+			data := resultJSON(t, result)
+			if data["message"] != err.Error() {
+				t.Errorf("message = %v, want %q", data["message"], err.Error())
+			}
+			if _, ok := data["details"]; !ok {
+				t.Error("error result has no details")
+			}
+		},
+	}
+}
+
+// onExistsArgs converts contents to out.html in dir with the given policy
+func onExistsArgs(onExists string) func(dir string) map[string]any {
+	return func(dir string) map[string]any {
+		return map[string]any{
+			"contents":    "# Title",
+			"output_file": filepath.Join(dir, "out.html"),
+			"on_exists":   onExists,
+		}
+	}
+}
+
+func TestConvertContents(t *testing.T) {
+	tests := []handlerCase{
+		{
+			name:      "missing input",
+			args:      func(dir string) map[string]any { return map[string]any{"output_format": "html"} },
+			wantError: pandoc.ErrorInvalidArgument,
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				if len(fake.Calls()) != 0 {
+					t.Error("converter called without input")
+				}
+			},
+		},
+		{
+			name: "contents and contents_base64 are mutually exclusive",
+			args: func(dir string) map[string]any {
+				return map[string]any{
+					"contents":        "# Title",
+					"contents_base64": base64.StdEncoding.EncodeToString([]byte("# Title")),
+					"input_format":    "markdown",
+				}
+			},
+			wantError: pandoc.ErrorInvalidArgument,
+		},
+		{
+			name: "pdf input format is rejected",
+			args: func(dir string) map[string]any {
+				return map[string]any{"contents": "text", "input_format": "pdf", "output_format": "html"}
+			},
+			wantError: pandoc.ErrorInvalidFormat,
+		},
+		{
+			name: "pdf content is rejected",
+			args: func(dir string) map[string]any {
+				return map[string]any{"contents_base64": base64.StdEncoding.EncodeToString([]byte("%PDF-1.7\n")), "output_format": "html"}
+			},
+			wantError: pandoc.ErrorInvalidFormat,
+		},
+		{
+			name: "unknown output format",
+			fake: &pandoctest.Fake{OutputFormats: []string{"html", "docx"}},
+			args: func(dir string) map[string]any {
+				return map[string]any{"contents": "# Title", "input_format": "markdown", "output_format": "nosuch"}
+			},
+			wantError: pandoc.ErrorInvalidFormat,
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				if len(fake.Calls()) != 0 {
+					t.Error("converter called for an unsupported format")
+				}
+			},
+		},
+		{
+			name:  "formats are inferred from the file extensions",
+			setup: func(t *testing.T, dir string) { writeFile(t, filepath.Join(dir, "doc.rst"), "Title\n=====\n") },
+			args: func(dir string) map[string]any {
+				return map[string]any{"input_file": filepath.Join(dir, "doc.rst"), "output_file": filepath.Join(dir, "doc.docx")}
+			},
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				call := onlyCall(t, fake)
+				if call.InputFormat != "rst" || call.OutputFormat != "docx" {
+					t.Errorf("converted %s → %s, want rst → docx", call.InputFormat, call.OutputFormat)
+				}
+				for key, want := range map[string]string{
+					"input_format_source":  pandoc.FormatSourceExtension,
+					"output_format_source": pandoc.FormatSourceExtension,
+				} {
+					if got := result.Meta[key]; got != want {
+						t.Errorf("%s = %v, want %s", key, got, want)
+					}
+				}
+			},
+		},
+		{
+			name: "input format is inferred from the content",
+			args: func(dir string) map[string]any {
+				return map[string]any{"contents": "<!DOCTYPE html><html><body><p>x</p></body></html>", "output_format": "markdown"}
+			},
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				if call := onlyCall(t, fake); call.InputFormat != "html" {
+					t.Errorf("input format = %s, want html", call.InputFormat)
+				}
+				if got := result.Meta["input_format_source"]; got != pandoc.FormatSourceContent {
+					t.Errorf("input_format_source = %v, want %s", got, pandoc.FormatSourceContent)
+				}
+			},
+		},
+		{
+			name: "input file outside the sandbox roots is denied",
+			args: func(dir string) map[string]any {
+				outside := filepath.Join(filepath.Dir(dir), "outside.md")
+				return map[string]any{"input_file": outside, "output_format": "html"}
+			},
+			wantError: pandoc.ErrorPathDenied,
+		},
+		{
+			name: "output file outside the sandbox roots is denied",
+			args: func(dir string) map[string]any {
+				outside := filepath.Join(filepath.Dir(dir), "outside.html")
+				return map[string]any{"contents": "# Title", "output_file": outside}
+			},
+			wantError: pandoc.ErrorPathDenied,
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "outside.html")); !os.IsNotExist(err) {
+					t.Error("denied output file was written")
+				}
+			},
+		},
+		{
+			name:      "timeout",
+			fake:      &pandoctest.Fake{Err: &pandoc.TimeoutError{Format: "html", Timeout: time.Second}},
+			args:      func(dir string) map[string]any { return map[string]any{"contents": "# Title", "output_format": "html"} },
+			wantError: pandoc.ErrorTimeout,
+		},
+		{
+			name:      "cancellation",
+			args:      func(dir string) map[string]any { return map[string]any{"contents": "# Title", "output_format": "html"} },
+			cancel:    true,
+			wantError: pandoc.ErrorCancelled,
+		},
+		{
+			name: "text result is returned inline without output_file",
+			args: func(dir string) map[string]any { return map[string]any{"contents": "# Title", "output_format": "html"} },
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				if got := resultText(t, result); got != fakeOutput {
+					t.Errorf("result = %q, want %q", got, fakeOutput)
+				}
+				if call := onlyCall(t, fake); call.OutputFile != "" {
+					t.Errorf("output file %s written for an inline result", call.OutputFile)
+				}
+			},
+		},
+		{
+			name: "binary result is embedded without output_file",
+			args: func(dir string) map[string]any { return map[string]any{"contents": "# Title", "output_format": "docx"} },
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				if len(result.Content) != 2 {
+					t.Fatalf("result has %d content items, want a summary and a resource", len(result.Content))
+				}
+				resource, ok := result.Content[1].(mcp.EmbeddedResource)
+				if !ok {
+					t.Fatalf("second content item is %T, want an embedded resource", result.Content[1])
+				}
+				blob, ok := resource.Resource.(mcp.BlobResourceContents)
+				if !ok {
+					t.Fatalf("resource is %T, want a blob", resource.Resource)
+				}
+				if data, _ := base64.StdEncoding.DecodeString(blob.Blob); string(data) != fakeOutput {
+					t.Errorf("blob = %q, want %q", data, fakeOutput)
+				}
+			},
+		},
+		{
+			name: "result is written to output_file",
+			args: func(dir string) map[string]any {
+				return map[string]any{"contents": "# Title", "output_file": filepath.Join(dir, "sub", "out.html")}
+			},
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				outputFile := filepath.Join(dir, "sub", "out.html")
+				if got := readFile(t, outputFile); got != fakeOutput {
+					t.Errorf("%s = %q, want %q", outputFile, got, fakeOutput)
+				}
+				if text := resultText(t, result); !strings.Contains(text, outputFile) {
+					t.Errorf("result %q does not name %s", text, outputFile)
+				}
+			},
+		},
+		{
+			name:  "text result of an input file is returned inline without output_file",
+			setup: func(t *testing.T, dir string) { writeFile(t, filepath.Join(dir, "doc.md"), "# Title\n") },
+			args: func(dir string) map[string]any {
+				return map[string]any{"input_file": filepath.Join(dir, "doc.md"), "output_format": "html"}
+			},
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				call := onlyCall(t, fake)
+				if call.Method != pandoctest.MethodConvertFile || call.InputFile != filepath.Join(dir, "doc.md") || call.OutputFile != "" {
+					t.Errorf("call = %s(%s → %q), want ConvertFile of doc.md without output file", call.Method, call.InputFile, call.OutputFile)
+				}
+				if got := resultText(t, result); got != fakeOutput {
+					t.Errorf("result = %q, want %q", got, fakeOutput)
+				}
+			},
+		},
+		{
+			name: "contents_base64 is decoded",
+			args: func(dir string) map[string]any {
+				return map[string]any{"contents_base64": "IyBUaXRsZQo", "input_format": "markdown", "output_format": "html"}
+			},
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				call := onlyCall(t, fake)
+				if call.Method != pandoctest.MethodConvertBytes || string(call.Content) != "# Title\n" {
+					t.Errorf("call = %s(%q), want ConvertBytes of the decoded content", call.Method, call.Content)
+				}
+			},
+		},
+		{
+			name: "invalid contents_base64",
+			args: func(dir string) map[string]any {
+				return map[string]any{"contents_base64": "not base64!", "output_format": "html"}
+			},
+			wantError: pandoc.ErrorInvalidArgument,
+		},
+		{
+			name: "contents_resource blob is decoded and named by its URI",
+			args: func(dir string) map[string]any {
+				return map[string]any{
+					"contents_resource": map[string]any{
+						"uri":  "file:///docs/notes.rst",
+						"blob": base64.StdEncoding.EncodeToString([]byte("Some text\n")),
+					},
+					"output_format": "html",
+				}
+			},
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				call := onlyCall(t, fake)
+				if string(call.Content) != "Some text\n" {
+					t.Errorf("content = %q, want the decoded blob", call.Content)
+				}
+				if call.InputFormat != "rst" || result.Meta["input_format_source"] != pandoc.FormatSourceExtension {
+					t.Errorf("input format = %s (%v), want rst from the URI extension", call.InputFormat, result.Meta["input_format_source"])
+				}
+			},
+		},
+		{
+			name: "contents_resource text with a media type",
+			args: func(dir string) map[string]any {
+				return map[string]any{
+					"contents_resource": map[string]any{"mimeType": "text/html", "text": "plain words"},
+					"output_format":     "markdown",
+				}
+			},
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				call := onlyCall(t, fake)
+				if string(call.Content) != "plain words" || call.InputFormat != "html" {
+					t.Errorf("call = %q as %s, want the text as html", call.Content, call.InputFormat)
+				}
+			},
+		},
+		{
+			name: "contents_resource without blob or text",
+			args: func(dir string) map[string]any {
+				return map[string]any{"contents_resource": map[string]any{"uri": "file:///x.md"}, "output_format": "html"}
+			},
+			wantError: pandoc.ErrorInvalidArgument,
+		},
+		{
+			name: "output_mode both writes the file and embeds it",
+			args: func(dir string) map[string]any {
+				return map[string]any{"contents": "# Title", "output_file": filepath.Join(dir, "out.docx"), "output_mode": "both"}
+			},
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				outputFile := filepath.Join(dir, "out.docx")
+				if got := readFile(t, outputFile); got != fakeOutput {
+					t.Errorf("%s = %q, want %q", outputFile, got, fakeOutput)
+				}
+				data := resultJSON(t, result)
+				if data["inline"] != true || data["output_file"] != outputFile {
+					t.Errorf("result = %v, want it inline and naming %s", data, outputFile)
+				}
+				if len(result.Content) != 2 {
+					t.Fatalf("result has %d content items, want a summary and a resource", len(result.Content))
+				}
+				if _, ok := result.Content[1].(mcp.EmbeddedResource); !ok {
+					t.Errorf("second content item is %T, want an embedded resource", result.Content[1])
+				}
+			},
+		},
+		{
+			name:      "output_mode both needs output_file",
+			args:      func(dir string) map[string]any { return map[string]any{"contents": "# Title", "output_mode": "both"} },
+			wantError: pandoc.ErrorInvalidArgument,
+		},
+		{
+			name:      "result above the inline limit needs output_file",
+			env:       map[string]string{"PANDOC_INLINE_MAX_BYTES": "4"},
+			args:      func(dir string) map[string]any { return map[string]any{"contents": "# Title", "output_format": "docx"} },
+			wantError: pandoc.ErrorInvalidArgument,
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				details, _ := resultJSON(t, result)["details"].(map[string]any)
+				if details["argument"] != "output_file" {
+					t.Errorf("details = %v, want the output_file argument", details)
+				}
+			},
+		},
+		{
+			name: "result above the inline limit is written to output_file",
+			env:  map[string]string{"PANDOC_INLINE_MAX_BYTES": "4"},
+			args: func(dir string) map[string]any {
+				return map[string]any{"contents": "# Title", "output_file": filepath.Join(dir, "out.docx"), "output_mode": "inline"}
+			},
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				outputFile := filepath.Join(dir, "out.docx")
+				if got := readFile(t, outputFile); got != fakeOutput {
+					t.Errorf("%s = %q, want %q", outputFile, got, fakeOutput)
+				}
+				if data := resultJSON(t, result); data["inline"] != false || data["output_file"] != outputFile {
+					t.Errorf("result = %v, want it written to %s instead of inline", data, outputFile)
+				}
+			},
+		},
+		errorKindCase("pandoc failure", &pandoc.PandocError{ExitCode: 64, Stderr: "parse error"}, pandoc.ErrorPandocFailed),
+		errorKindCase("missing LaTeX", &pandoc.MissingLatexError{Engine: "pdflatex", Stderr: "pdflatex not found"}, pandoc.ErrorMissingLatex),
+		errorKindCase("busy server", &pandoc.BusyError{Lane: "heavy", Queued: 8}, pandoc.ErrorServerBusy),
+		{
+			name: "missing input file",
+			args: func(dir string) map[string]any {
+				return map[string]any{"input_file": filepath.Join(dir, "missing.md"), "output_format": "html"}
+			},
+			wantError: pandoc.ErrorInputNotFound,
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				if len(fake.Calls()) != 0 {
+					t.Error("converter called for a missing input file")
+				}
+			},
+		},
+		{
+			name:  "on_exists overwrite replaces the file",
+			setup: existingOutput,
+			args:  onExistsArgs(pandoc.OnExistsOverwrite),
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				if got := readFile(t, filepath.Join(dir, "out.html")); got != fakeOutput {
+					t.Errorf("out.html = %q, want %q", got, fakeOutput)
+				}
+			},
+		},
+		{
+			name:      "on_exists fail keeps the file",
+			setup:     existingOutput,
+			args:      onExistsArgs(pandoc.OnExistsFail),
+			wantError: pandoc.ErrorOutputExists,
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				if got := readFile(t, filepath.Join(dir, "out.html")); got != "old" {
+					t.Errorf("out.html = %q, want it untouched", got)
+				}
+			},
+		},
+		{
+			name:  "on_exists rename writes next to the file",
+			setup: existingOutput,
+			args:  onExistsArgs(pandoc.OnExistsRename),
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				if got := readFile(t, filepath.Join(dir, "out.html")); got != "old" {
+					t.Errorf("out.html = %q, want it untouched", got)
+				}
+				if got := readFile(t, filepath.Join(dir, "out-1.html")); got != fakeOutput {
+					t.Errorf("out-1.html = %q, want %q", got, fakeOutput)
+				}
+			},
+		},
+		{
+			name:  "on_exists backup keeps the old file",
+			setup: existingOutput,
+			args:  onExistsArgs(pandoc.OnExistsBackup),
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				if got := readFile(t, filepath.Join(dir, "out.html")); got != fakeOutput {
+					t.Errorf("out.html = %q, want %q", got, fakeOutput)
+				}
+				if got := readFile(t, filepath.Join(dir, "out.html.bak")); got != "old" {
+					t.Errorf("out.html.bak = %q, want the old content", got)
+				}
+			},
+		},
+		{
+			name:      "unknown on_exists",
+			args:      onExistsArgs("append"),
+			wantError: pandoc.ErrorInvalidOption,
+		},
+		{
+			name: "warnings are reported",
+			fake: &pandoctest.Fake{
+				Output:   []byte(fakeOutput),
+				Warnings: []pandoc.Warning{{Type: "CouldNotFetchResource", Message: "missing.png"}},
+			},
+			args: func(dir string) map[string]any {
+				return map[string]any{"contents": "![x](missing.png)", "output_format": "html"}
+			},
+			check: func(t *testing.T, dir string, result *mcp.CallToolResult, fake *pandoctest.Fake) {
+				if _, ok := result.Meta["warnings"]; !ok {
+					t.Error("result metadata has no warnings")
+				}
+				if len(result.Content) != 2 {
+					t.Fatalf("result has %d content items, want the document and the warnings", len(result.Content))
+				}
+				text, _ := result.Content[1].(mcp.TextContent)
+				if !strings.Contains(text.Text, "missing.png") {
+					t.Errorf("warnings item = %q, want the missing image", text.Text)
+				}
+			},
+		},
+	}
+
+	logging.InitGlobalLogger("", io.Discard)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("PANDOC_INLINE_MAX_BYTES", "")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			if tt.setup != nil {
+				tt.setup(t, dir)
+			}
+			fake := tt.fake
+			if fake == nil {
+				fake = pandoctest.NewFake(fakeOutput)
+			}
+
+			ctx := context.Background()
+			if tt.cancel {
+				cancelled, cancel := context.WithCancel(ctx)
+				cancel()
+				ctx = cancelled
+			}
+			result, err := callConvertContents(ctx, NewHandler(fake, sandbox.New([]string{dir}, nil, nil, nil)), tt.args(dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantError != "" {
+				if !result.IsError {
+					t.Fatalf("request succeeded, want %s error:\n%s", tt.wantError, resultText(t, result))
+				}
+				if got := resultJSON(t, result)["error"]; got != tt.wantError {
+					t.Errorf("error = %v, want %s:\n%s", got, tt.wantError, resultText(t, result))
+				}
+			} else if result.IsError {
+				t.Fatalf("request failed: %s", resultText(t, result))
+			}
+			if tt.check != nil {
+				tt.check(t, dir, result, fake)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package tools
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+)
+
+// binaryInput is document content received over the protocol instead of
+// being read from a file on the server
+type binaryInput struct {
+	data []byte
+	// name and mimeType come from an embedded resource and help infer the format
+	name     string
+	mimeType string
+}
+
+// parseBinaryInput extracts document content from the contents_base64 or
+// contents_resource argument, nil if neither is given
+func parseBinaryInput(args map[string]any) (*binaryInput, error) {
+	encoded, err := stringArg(args, "contents_base64")
+	if err != nil {
+		return nil, err
+	}
+	resource, hasResource := args["contents_resource"]
+	if hasResource && resource == nil {
+		hasResource = false
+	}
+
+	if encoded != "" && hasResource {
+		return nil, &pandoc.ArgumentError{Argument: "contents_resource", Reason: "only one of contents_base64 and contents_resource may be provided"}
+	}
+	if encoded != "" {
+		data, err := decodeBase64(encoded)
+		if err != nil {
+			return nil, &pandoc.ArgumentError{Argument: "contents_base64", Reason: fmt.Sprintf("not valid base64: %v", err)}
+		}
+		return &binaryInput{data: data}, nil
+	}
+	if !hasResource {
+		return nil, nil
+	}
+
+	// Same shape as the blob or text resource contents of an embedded resource
+	obj, ok := resource.(map[string]any)
+	if !ok {
+		return nil, &pandoc.ArgumentError{Argument: "contents_resource", Reason: "must be an object"}
+	}
+	input := &binaryInput{}
+	input.mimeType, _ = obj["mimeType"].(string)
+	if uri, _ := obj["uri"].(string); uri != "" {
+		if u, err := url.Parse(uri); err == nil && u.Path != "" {
+			input.name = path.Base(u.Path)
+		} else {
+			input.name = path.Base(uri)
+		}
+	}
+
+	if blob, ok := obj["blob"].(string); ok {
+		data, err := decodeBase64(blob)
+		if err != nil {
+			return nil, &pandoc.ArgumentError{Argument: "contents_resource.blob", Reason: fmt.Sprintf("not valid base64: %v", err)}
+		}
+		input.data = data
+	} else if text, ok := obj["text"].(string); ok {
+		input.data = []byte(text)
+	} else {
+		return nil, &pandoc.ArgumentError{Argument: "contents_resource", Reason: "must have a blob or text field"}
+	}
+	return input, nil
+}
+
+// decodeBase64 decodes standard or URL-safe base64, with or without padding
+// and line breaks
+func decodeBase64(encoded string) ([]byte, error) {
+	encoded = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, encoded)
+	encoded = strings.TrimRight(encoded, "=")
+
+	if strings.ContainsAny(encoded, "-_") {
+		return base64.RawURLEncoding.DecodeString(encoded)
+	}
+	return base64.RawStdEncoding.DecodeString(encoded)
+}
@@ -0,0 +1,200 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+)
+
+// parseOptions extracts the typed conversion options from tool arguments
+func parseOptions(args map[string]any) (pandoc.Options, error) {
+	var opts pandoc.Options
+	var err error
+
+	if opts.Branding, err = optionalBool(args, "branding"); err != nil {
+		return opts, err
+	}
+	if opts.TOC, err = boolArg(args, "toc"); err != nil {
+		return opts, err
+	}
+	if opts.Standalone, err = boolArg(args, "standalone"); err != nil {
+		return opts, err
+	}
+	if opts.NumberSections, err = boolArg(args, "number_sections"); err != nil {
+		return opts, err
+	}
+	if opts.TOCDepth, err = intArg(args, "toc_depth"); err != nil {
+		return opts, err
+	}
+	if opts.Columns, err = intArg(args, "columns"); err != nil {
+		return opts, err
+	}
+	if opts.ShiftHeadingLevel, err = intArg(args, "shift_heading_level"); err != nil {
+		return opts, err
+	}
+	if opts.Template, err = stringArg(args, "template"); err != nil {
+		return opts, err
+	}
+	if opts.Filters, err = stringListArg(args, "filters"); err != nil {
+		return opts, err
+	}
+	if opts.Bibliography, err = stringArg(args, "bibliography"); err != nil {
+		return opts, err
+	}
+	if opts.References, err = objectListArg(args, "references"); err != nil {
+		return opts, err
+	}
+	if opts.CSL, err = stringArg(args, "csl"); err != nil {
+		return opts, err
+	}
+	if opts.LinkCitations, err = boolArg(args, "link_citations"); err != nil {
+		return opts, err
+	}
+	if opts.LinkBibliography, err = boolArg(args, "link_bibliography"); err != nil {
+		return opts, err
+	}
+	if opts.OnExists, err = stringArg(args, "on_exists"); err != nil {
+		return opts, err
+	}
+	if opts.AllowRemoteResources, err = boolArg(args, "allow_remote_resources"); err != nil {
+		return opts, err
+	}
+	if opts.NoCache, err = boolArg(args, "no_cache"); err != nil {
+		return opts, err
+	}
+	if opts.HighlightStyle, err = stringArg(args, "highlight_style"); err != nil {
+		return opts, err
+	}
+	if opts.Wrap, err = stringArg(args, "wrap"); err != nil {
+		return opts, err
+	}
+	if opts.EOL, err = stringArg(args, "eol"); err != nil {
+		return opts, err
+	}
+	if opts.Metadata, err = stringMapArg(args, "metadata"); err != nil {
+		return opts, err
+	}
+	if opts.Variables, err = stringMapArg(args, "variables"); err != nil {
+		return opts, err
+	}
+
+	return opts, opts.Validate()
+}
+
+// optionalBool returns a pointer to a boolean argument, nil if it is absent
+func optionalBool(args map[string]any, name string) (*bool, error) {
+	val, ok := args[name]
+	if !ok || val == nil {
+		return nil, nil
+	}
+	b, ok := val.(bool)
+	if !ok {
+		return nil, &pandoc.ArgumentError{Argument: name, Reason: "must be a boolean"}
+	}
+	return &b, nil
+}
+
+// boolArg returns a boolean argument, false if it is absent
+func boolArg(args map[string]any, name string) (bool, error) {
+	b, err := optionalBool(args, name)
+	if err != nil || b == nil {
+		return false, err
+	}
+	return *b, nil
+}
+
+// intArg returns an integer argument, 0 if it is absent
+func intArg(args map[string]any, name string) (int, error) {
+	val, ok := args[name]
+	if !ok || val == nil {
+		return 0, nil
+	}
+	n, ok := val.(float64)
+	if !ok || n != math.Trunc(n) {
+		return 0, &pandoc.ArgumentError{Argument: name, Reason: "must be an integer"}
+	}
+	return int(n), nil
+}
+
+// stringArg returns a string argument, "" if it is absent
+func stringArg(args map[string]any, name string) (string, error) {
+	val, ok := args[name]
+	if !ok || val == nil {
+		return "", nil
+	}
+	s, ok := val.(string)
+	if !ok {
+		return "", &pandoc.ArgumentError{Argument: name, Reason: "must be a string"}
+	}
+	return s, nil
+}
+
+// stringMapArg returns an object argument with scalar values converted to strings
+func stringMapArg(args map[string]any, name string) (map[string]string, error) {
+	val, ok := args[name]
+	if !ok || val == nil {
+		return nil, nil
+	}
+	obj, ok := val.(map[string]any)
+	if !ok {
+		return nil, &pandoc.ArgumentError{Argument: name, Reason: "must be an object"}
+	}
+
+	result := make(map[string]string, len(obj))
+	for key, v := range obj {
+		switch v := v.(type) {
+		case string:
+			result[key] = v
+		case bool, float64:
+			result[key] = fmt.Sprint(v)
+		default:
+			return nil, &pandoc.ArgumentError{Argument: name + "." + key, Reason: "must be a string, number or boolean"}
+		}
+	}
+	return result, nil
+}
+
+// stringListArg returns an array argument of strings, nil if it is absent
+func stringListArg(args map[string]any, name string) ([]string, error) {
+	val, ok := args[name]
+	if !ok || val == nil {
+		return nil, nil
+	}
+	items, ok := val.([]any)
+	if !ok {
+		return nil, &pandoc.ArgumentError{Argument: name, Reason: "must be an array of strings"}
+	}
+
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, &pandoc.ArgumentError{Argument: name, Reason: "must be an array of strings"}
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// objectListArg returns an array argument of objects, nil if it is absent
+func objectListArg(args map[string]any, name string) ([]map[string]any, error) {
+	val, ok := args[name]
+	if !ok || val == nil {
+		return nil, nil
+	}
+	items, ok := val.([]any)
+	if !ok {
+		return nil, &pandoc.ArgumentError{Argument: name, Reason: "must be an array of objects"}
+	}
+
+	result := make([]map[string]any, 0, len(items))
+	for _, item := range items {
+		obj, ok := item.(map[string]any)
+		if !ok {
+			return nil, &pandoc.ArgumentError{Argument: name, Reason: "must be an array of objects"}
+		}
+		result = append(result, obj)
+	}
+	return result, nil
+}
@@ -0,0 +1,169 @@
+package tools
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/logging"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+)
+
+// Output modes of convert_contents
+const (
+	// OutputModeFile writes the result to output_file and returns its path
+	OutputModeFile = "file"
+	// OutputModeInline returns the result as an embedded resource
+	OutputModeInline = "inline"
+	// OutputModeBoth writes output_file and also returns the result inline
+	OutputModeBoth = "both"
+)
+
+// DefaultInlineLimit is the largest result returned inline, in bytes
+const DefaultInlineLimit = 10 << 20
+
+// inlineLimitFromEnv reads the inline size cap from PANDOC_INLINE_MAX_BYTES
+func inlineLimitFromEnv() int {
+	if value := os.Getenv("PANDOC_INLINE_MAX_BYTES"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			return n
+		}
+		logging.GetGlobalLogger().Error("Некорректное значение PANDOC_INLINE_MAX_BYTES: %s", value)
+	}
+	return DefaultInlineLimit
+}
+
+// resolveOutputMode validates the requested output mode or picks the default:
+// file when output_file is given, inline for binary formats without one.
+// Text results without output_file keep being returned as plain text, which
+// is reported as an empty mode.
+func resolveOutputMode(mode, outputFile, outputFormat string) (string, error) {
+	switch mode {
+	case "":
+		if outputFile != "" {
+			return OutputModeFile, nil
+		}
+		if pandoc.NeedsOutputFile(outputFormat) {
+			return OutputModeInline, nil
+		}
+		return "", nil
+	case OutputModeFile, OutputModeBoth:
+		if outputFile == "" {
+			return "", &pandoc.ArgumentError{Argument: "output_file", Reason: "required for output_mode " + mode}
+		}
+		return mode, nil
+	case OutputModeInline:
+		return mode, nil
+	}
+	return "", &pandoc.ArgumentError{Argument: "output_mode", Reason: mode + " is not one of file, inline or both"}
+}
+
+// inlineResult returns the converted document as an embedded resource: a
+// base64 blob for binary formats and text contents otherwise. Results larger
+// than the inline cap are written to output_file instead; without one they
+// are rejected, as the server has no place of its own to keep them.
+func inlineResult(mode string, converted *pandoc.Result, outputFormat, inputFile, outputFile, onExists string, formats map[string]any) (*mcp.CallToolResult, error) {
+	logger := logging.GetGlobalLogger()
+
+	content := converted.Output
+	writtenFile := ""
+	if mode == OutputModeBoth {
+		data, err := os.ReadFile(converted.OutputFile)
+		if err != nil {
+			logger.FileOperation("READ_OUTPUT", converted.OutputFile, false, fmt.Sprintf("Ошибка: %v", err))
+			return errorResult(fmt.Errorf("Failed to read output file: %v", err))
+		}
+		content = data
+		writtenFile = converted.OutputFile
+	}
+
+	mimeType := pandoc.MIMEType(outputFormat)
+	data := map[string]any{
+		"mime_type": mimeType,
+		"size":      len(content),
+	}
+	for key, value := range formats {
+		data[key] = value
+	}
+	if len(converted.Warnings) > 0 {
+		data["warnings"] = converted.Warnings
+	}
+
+	limit := inlineLimitFromEnv()
+	if len(content) > limit {
+		// Too large for the response: fall back to output_file
+		if writtenFile == "" {
+			if outputFile == "" {
+				logger.Error("Результат (%d байт) превышает лимит для встраивания (%d байт), output_file не указан", len(content), limit)
+				return errorResult(&pandoc.ArgumentError{
+					Argument: "output_file",
+					Reason:   fmt.Sprintf("required for results above the inline limit of %d bytes (this one is %d bytes)", limit, len(content)),
+				})
+			}
+			path, err := pandoc.WriteOutputFile(content, outputFile, onExists)
+			if err != nil {
+				logger.FileOperation("WRITE_OUTPUT", outputFile, false, fmt.Sprintf("Ошибка: %v", err))
+				return errorResult(fmt.Errorf("Failed to write output file: %w", err))
+			}
+			logger.FileOperation("WRITE_OUTPUT", path, true, "Результат превышает лимит для встраивания")
+			writtenFile = path
+		}
+		data["output_file"] = writtenFile
+		data["inline"] = false
+		data["message"] = fmt.Sprintf("Result is %d bytes, above the inline limit of %d bytes; written to %s", len(content), limit, writtenFile)
+
+		jsonData, _ := json.Marshal(data)
+		logger.Trace("Возвращаем результат конвертации (путь к файлу вместо встраивания): %s", writtenFile)
+		return withFormats(mcp.NewToolResultText(string(jsonData)), formats), nil
+	}
+
+	uri := resourceURI(writtenFile, inputFile, outputFormat)
+	var resource mcp.ResourceContents
+	if pandoc.IsBinaryFormat(outputFormat) {
+		resource = mcp.BlobResourceContents{
+			URI:      uri,
+			MIMEType: mimeType,
+			Blob:     base64.StdEncoding.EncodeToString(content),
+		}
+	} else {
+		resource = mcp.TextResourceContents{
+			URI:      uri,
+			MIMEType: mimeType,
+			Text:     string(content),
+		}
+	}
+
+	data["uri"] = uri
+	data["inline"] = true
+	data["message"] = fmt.Sprintf("Converted %s document returned as an embedded resource", outputFormat)
+	if writtenFile != "" {
+		data["output_file"] = writtenFile
+	}
+
+	jsonData, _ := json.Marshal(data)
+	logger.Trace("Возвращаем результат конвертации (встроенный ресурс %s, %d байт)", mimeType, len(content))
+	return withFormats(mcp.NewToolResultResource(string(jsonData), resource), formats), nil
+}
+
+// resourceURI names an embedded result: the file:// URI of the written file,
+// or a pandoc:// URI named after the input file
+func resourceURI(writtenFile, inputFile, outputFormat string) string {
+	if writtenFile != "" {
+		if abs, err := filepath.Abs(writtenFile); err == nil {
+			writtenFile = abs
+		}
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(writtenFile)}).String()
+	}
+
+	name := "document"
+	if inputFile != "" {
+		name = strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))
+	}
+	return "pandoc://output/" + url.PathEscape(name+pandoc.FileExtension(outputFormat))
+}
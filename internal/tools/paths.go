@@ -0,0 +1,34 @@
+package tools
+
+import (
+	"path/filepath"
+
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/sandbox"
+)
+
+// checkPath checks a client-supplied path against the sandbox policy and
+// returns it resolved, with symlinks followed
+func checkPath(policy *sandbox.Policy, path, access string) (string, error) {
+	if access == sandbox.AccessWrite {
+		return policy.CheckWrite(path)
+	}
+	return policy.CheckRead(path)
+}
+
+// resourcePath returns the directories pandoc may load images from: the
+// directories of the input files and the allowed read roots. It is empty, so
+// pandoc keeps its default, when neither applies.
+func resourcePath(policy *sandbox.Policy, inputFiles ...string) []string {
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, inputFile := range inputFiles {
+		if dir := filepath.Dir(inputFile); inputFile != "" && !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	if policy.Restricted() {
+		dirs = append(dirs, policy.Roots(sandbox.AccessRead)...)
+	}
+	return dirs
+}
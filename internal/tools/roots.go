@@ -0,0 +1,161 @@
+package tools
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/logging"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/sandbox"
+)
+
+// rootsRequestPrefix marks the IDs of roots/list requests sent by the server
+const rootsRequestPrefix = "pandoc-roots-"
+
+// RootsClient asks the MCP client for its roots and keeps the sandbox policy
+// up to date. The stdio transport cannot send requests to the client, so
+// RootsClient writes them to the output itself and takes the responses out
+// of the input before the transport sees them.
+type RootsClient struct {
+	policy *sandbox.Policy
+
+	mu        sync.Mutex
+	out       io.Writer
+	supported bool
+	seq       int
+}
+
+// NewRootsClient creates a client updating policy
+func NewRootsClient(policy *sandbox.Policy) *RootsClient {
+	return &RootsClient{policy: policy}
+}
+
+// Output returns a writer for the transport's output. Every write is one
+// whole message, so requests from RootsClient never interleave with responses.
+func (c *RootsClient) Output(w io.Writer) io.Writer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.out = &lockedWriter{w: w}
+	return c.out
+}
+
+// WatchInput returns a reader that forwards everything from in except the
+// responses to roots/list, requesting the roots once the session is
+// initialized and again whenever the client reports that they changed
+func (c *RootsClient) WatchInput(in io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+
+	go func() {
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 && c.inspect(line) {
+				if _, werr := pw.Write(line); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	return pr
+}
+
+// inspect handles the messages RootsClient cares about and reports whether
+// line should be passed on to the transport
+func (c *RootsClient) inspect(line []byte) bool {
+	var msg struct {
+		ID     any    `json:"id"`
+		Method string `json:"method"`
+		Params struct {
+			Capabilities struct {
+				Roots *struct{} `json:"roots"`
+			} `json:"capabilities"`
+		} `json:"params"`
+		Result *struct {
+			Roots []struct {
+				URI  string `json:"uri"`
+				Name string `json:"name"`
+			} `json:"roots"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return true
+	}
+
+	switch msg.Method {
+	case "initialize":
+		c.mu.Lock()
+		c.supported = msg.Params.Capabilities.Roots != nil
+		c.mu.Unlock()
+		return true
+	case "notifications/initialized", "notifications/roots/list_changed":
+		c.requestRoots()
+		return true
+	case "":
+		id, _ := msg.ID.(string)
+		if !strings.HasPrefix(id, rootsRequestPrefix) {
+			return true
+		}
+	default:
+		return true
+	}
+
+	// Response to our roots/list request
+	logger := logging.GetGlobalLogger()
+	if msg.Error != nil || msg.Result == nil {
+		if msg.Error != nil {
+			logger.Error("Клиент не вернул список корневых директорий: %s", msg.Error.Message)
+		}
+		return false
+	}
+	uris := make([]string, 0, len(msg.Result.Roots))
+	for _, root := range msg.Result.Roots {
+		uris = append(uris, root.URI)
+	}
+	ignored := c.policy.SetClientRoots(uris)
+	logger.Info("Корневые директории клиента: %s", strings.Join(uris, ", "))
+	if len(ignored) > 0 {
+		logger.Warn("Корневые директории клиента вне разрешённых в конфигурации игнорируются: %s", strings.Join(ignored, ", "))
+	}
+	return false
+}
+
+// requestRoots sends roots/list if the client supports it
+func (c *RootsClient) requestRoots() {
+	c.mu.Lock()
+	if !c.supported || c.out == nil {
+		c.mu.Unlock()
+		return
+	}
+	c.seq++
+	id := fmt.Sprintf("%s%d", rootsRequestPrefix, c.seq)
+	out := c.out
+	c.mu.Unlock()
+
+	request := fmt.Sprintf(`{"jsonrpc":"2.0","id":%q,"method":"roots/list"}`+"\n", id)
+	if _, err := io.WriteString(out, request); err != nil {
+		logging.GetGlobalLogger().Error("Не удалось запросить корневые директории клиента: %v", err)
+	}
+}
+
+// lockedWriter serializes writes to w
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,46 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/logging"
+	"github.com/snowwhiteai/mcp-pandoc-go/internal/pandoc"
+)
+
+// TemplatesHandler serves the list_templates tool
+type TemplatesHandler struct {
+	registry *pandoc.TemplateRegistry
+}
+
+// NewTemplatesHandler creates the list_templates handler for the registry
+// the converter resolves templates with
+func NewTemplatesHandler(registry *pandoc.TemplateRegistry) *TemplatesHandler {
+	return &TemplatesHandler{registry: registry}
+}
+
+// ListTemplates lists the named templates available for the template argument
+func (h *TemplatesHandler) ListTemplates(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	logger := logging.GetGlobalLogger()
+	logger.DetailedInfo("Начало обработки запроса list_templates")
+
+	registry := h.registry
+	templates, err := registry.List()
+	if err != nil {
+		logger.Error("Не удалось получить список шаблонов: %v", err)
+		return errorResult(fmt.Errorf("Failed to list templates: %v", err))
+	}
+	if templates == nil {
+		templates = []pandoc.Template{}
+	}
+	logger.Trace("Найдено шаблонов: %d в %s", len(templates), registry.Dir())
+
+	data := map[string]any{
+		"templates_dir": registry.Dir(),
+		"templates":     templates,
+	}
+	jsonData, _ := json.Marshal(data)
+	return mcp.NewToolResultText(string(jsonData)), nil
+}